@@ -3,6 +3,7 @@ package orm
 import (
 	"WebFramework/orm/internal/valuer"
 	"WebFramework/orm/model"
+	"context"
 	"database/sql"
 )
 
@@ -53,3 +54,8 @@ func MustOpen(driver, datasourceName string, opts ...DBOption) *DB {
 	}
 	return db
 }
+
+// PingContext 检查数据库连接是否可用
+func (db *DB) PingContext(ctx context.Context) error {
+	return db.sqldb.PingContext(ctx)
+}
@@ -0,0 +1,152 @@
+package admin
+
+import (
+	"WebFramework/web"
+	"context"
+	"crypto/subtle"
+	"expvar"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// Target 被管理的server，web.NewHttpServer 返回的server满足这个接口
+type Target interface {
+	Routes() []web.RouteInfo
+	Middlewares() []string
+	Attach(svc web.Service)
+}
+
+type Options struct {
+	// Addr 管理server监听的地址，例如 127.0.0.1:8081
+	Addr string
+	// Auth 保护所有管理接口的中间件，例如 BasicAuth
+	Auth web.Middleware
+	// Gatherer 暴露的Prometheus指标，默认是 prometheus.DefaultGatherer
+	Gatherer prometheus.Gatherer
+}
+
+// Server 单独端口上的管理server，和业务server一起启动、一起关闭
+// - /debug/pprof/* pprof
+// - /debug/vars expvar
+// - /routes 路由表
+// - /middlewares server级别的中间件
+// - /runtime goroutine数量、内存等运行时信息
+// - /metrics Prometheus指标
+type Server struct {
+	addr   string
+	server web.Server
+	target Target
+	start  time.Time
+}
+
+// New 创建管理server并关联到 target 的生命周期上
+func New(target Target, opt Options) *Server {
+	var mdls []web.Middleware
+	if opt.Auth != nil {
+		mdls = append(mdls, opt.Auth)
+	}
+	if opt.Gatherer == nil {
+		opt.Gatherer = prometheus.DefaultGatherer
+	}
+	s := web.NewHttpServer(web.WithMiddleware(mdls...))
+	res := &Server{
+		addr:   opt.Addr,
+		server: s,
+		target: target,
+		start:  time.Now(),
+	}
+
+	s.Get("/debug/pprof", web.WrapHandler(http.HandlerFunc(pprof.Index)))
+	s.Get("/debug/pprof/*", web.WrapHandler(http.HandlerFunc(pprof.Index)))
+	s.Get("/debug/pprof/cmdline", web.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	s.Get("/debug/pprof/profile", web.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	s.Get("/debug/pprof/symbol", web.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	s.Post("/debug/pprof/symbol", web.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	s.Get("/debug/pprof/trace", web.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	s.Get("/debug/vars", web.WrapHandler(expvar.Handler()))
+	s.Get("/metrics", web.WrapHandler(promhttp.HandlerFor(opt.Gatherer, promhttp.HandlerOpts{})))
+	s.Get("/routes", res.routes)
+	s.Get("/middlewares", res.middlewares)
+	s.Get("/runtime", res.runtime)
+
+	target.Attach(res)
+	return res
+}
+
+// Start 由业务server启动的时候调用
+func (s *Server) Start() error {
+	return s.server.Start(s.addr)
+}
+
+// Shutdown 由业务server关闭的时候调用
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Handler 不监听端口直接处理请求，方便测试
+func (s *Server) Handler() http.Handler {
+	return s.server
+}
+
+func (s *Server) routes(c *web.Context) {
+	c.JSON(http.StatusOK, s.target.Routes())
+}
+
+func (s *Server) middlewares(c *web.Context) {
+	c.JSON(http.StatusOK, map[string]any{
+		"middlewares": s.target.Middlewares(),
+	})
+}
+
+type runtimeStats struct {
+	Goroutines   int    `json:"goroutines"`
+	GOMAXPROCS   int    `json:"gomaxprocs"`
+	NumCPU       int    `json:"num_cpu"`
+	GoVersion    string `json:"go_version"`
+	Uptime       string `json:"uptime"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	TotalAlloc   uint64 `json:"total_alloc"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+}
+
+func (s *Server) runtime(c *web.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	c.JSON(http.StatusOK, runtimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		GoVersion:    runtime.Version(),
+		Uptime:       time.Since(s.start).String(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapObjects:  m.HeapObjects,
+		TotalAlloc:   m.TotalAlloc,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalNs: m.PauseTotalNs,
+	})
+}
+
+// BasicAuth 使用HTTP Basic认证保护管理接口
+func BasicAuth(username, password string) web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			user, pass, ok := c.Request.BasicAuth()
+			if !ok ||
+				subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+				c.Writer.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			next(c)
+		}
+	}
+}
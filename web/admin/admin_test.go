@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"WebFramework/web"
+	"context"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s := web.NewHttpServer(web.WithMiddleware(func(next web.HandleFunc) web.HandleFunc {
+		return next
+	}))
+	s.Get("/user/:id", func(c *web.Context) {})
+	s.Post("/user", func(c *web.Context) {})
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "admin_test_total"})
+	registry.MustRegister(counter)
+	counter.Inc()
+
+	a := New(s, Options{Auth: BasicAuth("admin", "123"), Gatherer: registry})
+
+	request := func(path string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth {
+			req.SetBasicAuth("admin", "123")
+		}
+		recorder := httptest.NewRecorder()
+		a.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	resp := request("/routes", false)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, `Basic realm="admin"`, resp.Header().Get("WWW-Authenticate"))
+
+	resp = request("/routes", true)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var routes []web.RouteInfo
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &routes))
+	assert.Equal(t, []web.RouteInfo{
+		{Method: http.MethodPost, Path: "/user"},
+		{Method: http.MethodGet, Path: "/user/:id"},
+	}, routes)
+
+	resp = request("/middlewares", true)
+	assert.Contains(t, resp.Body.String(), "admin.TestServer.func1")
+
+	resp = request("/runtime", true)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"goroutines":`)
+
+	resp = request("/metrics", true)
+	assert.Contains(t, resp.Body.String(), "admin_test_total 1")
+
+	resp = request("/debug/vars", true)
+	assert.Contains(t, resp.Body.String(), "memstats")
+
+	resp = request("/debug/pprof/", true)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "goroutine")
+
+	resp = request("/debug/pprof/goroutine?debug=1", true)
+	assert.True(t, strings.HasPrefix(resp.Body.String(), "goroutine profile"))
+}
+
+// 管理server跟随业务server启动和关闭
+func TestServer_Lifecycle(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	s := web.NewHttpServer()
+	New(s, Options{Addr: addr})
+
+	go func() {
+		_ = s.Start("127.0.0.1:0")
+	}()
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/runtime")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	_, err = http.Get("http://" + addr + "/runtime")
+	assert.Error(t, err)
+}
@@ -0,0 +1,327 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validator 请求结构体可以实现这个接口做自定义校验
+type Validator interface {
+	Validate() error
+}
+
+// FieldError 某个字段没有通过校验
+type FieldError struct {
+	Field string
+	// Rule 没有通过的规则，例如 required、min、max
+	Rule  string
+	Param string
+}
+
+func (e FieldError) Error() string {
+	if e.Param != "" {
+		return fmt.Sprintf("field '%s' failed on '%s=%s'", e.Field, e.Rule, e.Param)
+	}
+	return fmt.Sprintf("field '%s' failed on '%s'", e.Field, e.Rule)
+}
+
+// Localize 以 validation.<Rule> 为key翻译错误信息，可以使用 {field} 和 {param} 两个参数
+// 找不到翻译的时候返回 Error 的结果
+func (e FieldError) Localize(t Translator) string {
+	if t == nil {
+		return e.Error()
+	}
+	key := "validation." + e.Rule
+	msg := t.T(key, "field", e.Field, "param", e.Param)
+	if msg == key {
+		return e.Error()
+	}
+	return msg
+}
+
+// ValidationErrors 所有没有通过校验的字段
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	return e.Localize(nil)
+}
+
+// Localize 翻译所有字段的错误信息
+func (e ValidationErrors) Localize(t Translator) string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Localize(t))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// bindError 请求本身有问题，例如请求体不是合法的JSON、参数的类型不对，msg 可以返回给客户端
+type bindError struct {
+	msg string
+	err error
+}
+
+func (e *bindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *bindError) Unwrap() error {
+	return e.err
+}
+
+// tagError 结构体的标签写错了，例如未知的校验规则，是代码的问题而不是请求的问题
+type tagError struct {
+	msg string
+}
+
+func (e *tagError) Error() string {
+	return e.msg
+}
+
+// Bind 把请求绑定到结构体上并校验
+// - 请求体按照JSON解析
+// - `path:"id"` 绑定路径参数，`query:"name"` 绑定查询参数，`header:"X-Token"` 绑定请求头，会覆盖请求体里面的值
+// - `validate:"required,min=1,max=10"` 校验字段，min和max对数字比较大小，对字符串和切片比较长度
+// - 最后如果实现了 Validator 接口，调用 Validate
+func (c *Context) Bind(val any) error {
+	rv := reflect.ValueOf(val)
+	if val == nil || rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("web: bind only supports pointer to struct")
+	}
+
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return &bindError{msg: "invalid request body", err: err}
+		}
+		if len(body) > 0 {
+			if err = json.Unmarshal(body, val); err != nil {
+				return &bindError{msg: "invalid request body", err: err}
+			}
+		}
+	}
+
+	if err := c.bindValues(rv.Elem()); err != nil {
+		return err
+	}
+	if err := validateStruct(rv.Elem()); err != nil {
+		return err
+	}
+	if v, ok := val.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// bindValues 绑定路径参数、查询参数和请求头
+func (c *Context) bindValues(v reflect.Value) error {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		if !fd.IsExported() {
+			continue
+		}
+		var vals []string
+		var source string
+		if name, ok := fd.Tag.Lookup("path"); ok {
+			if val, ok := c.Params[name]; ok {
+				vals, source = []string{val}, name
+			}
+		}
+		if name, ok := fd.Tag.Lookup("query"); ok {
+			if c.queryValues == nil {
+				c.queryValues = c.Request.URL.Query()
+			}
+			if val, ok := c.queryValues[name]; ok {
+				vals, source = val, name
+			}
+		}
+		if name, ok := fd.Tag.Lookup("header"); ok {
+			if val := c.Request.Header.Values(name); len(val) > 0 {
+				vals, source = val, name
+			}
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), vals); err != nil {
+			var te *tagError
+			if errors.As(err, &te) {
+				return err
+			}
+			return &bindError{
+				msg: fmt.Sprintf("invalid value for '%s'", source),
+				err: fmt.Errorf("web: bind field '%s': %w", fd.Name, err),
+			}
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, vals []string) error {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setValue(field, vals[0])
+}
+
+func setValue(field reflect.Value, val string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return &tagError{msg: fmt.Sprintf("web: bind unsupported type %s", field.Type())}
+	}
+	return nil
+}
+
+// validateStruct 根据 validate 标签校验
+func validateStruct(v reflect.Value) error {
+	var errs ValidationErrors
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		tag, ok := fd.Tag.Lookup("validate")
+		if !ok || !fd.IsExported() {
+			continue
+		}
+		field := v.Field(i)
+		for _, rule := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+			ok, err := checkRule(field, name, param)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				errs = append(errs, FieldError{Field: fieldName(fd), Rule: name, Param: param})
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkRule(field reflect.Value, rule, param string) (bool, error) {
+	if rule == "required" {
+		return !field.IsZero(), nil
+	}
+	if rule != "min" && rule != "max" {
+		return false, &tagError{msg: fmt.Sprintf("web: unknown validate rule '%s'", rule)}
+	}
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false, &tagError{msg: fmt.Sprintf("web: invalid validate param '%s'", param)}
+	}
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return true, nil
+		}
+		field = field.Elem()
+	}
+	var actual float64
+	switch field.Kind() {
+	case reflect.String:
+		actual = float64(len([]rune(field.String())))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		actual = float64(field.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = field.Float()
+	default:
+		return false, &tagError{msg: fmt.Sprintf("web: rule '%s' unsupported for type %s", rule, field.Type())}
+	}
+	if rule == "min" {
+		return actual >= limit, nil
+	}
+	return actual <= limit, nil
+}
+
+// checkTags 不处理请求，提前检查 validate 规则和绑定参数的字段类型，typ 必须是结构体
+func checkTags(typ reflect.Type) error {
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		if !fd.IsExported() {
+			continue
+		}
+		// 用零值走一遍校验和赋值，能发现所有和请求无关的错误
+		field := reflect.New(fd.Type).Elem()
+		if tag, ok := fd.Tag.Lookup("validate"); ok {
+			if field.Kind() == reflect.Pointer {
+				field = reflect.New(fd.Type.Elem())
+			}
+			for _, rule := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+				if _, err := checkRule(field, name, param); err != nil {
+					return fmt.Errorf("field '%s': %w", fd.Name, err)
+				}
+			}
+		}
+		_, path := fd.Tag.Lookup("path")
+		_, query := fd.Tag.Lookup("query")
+		_, header := fd.Tag.Lookup("header")
+		if path || query || header {
+			var te *tagError
+			if err := setField(reflect.New(fd.Type).Elem(), []string{"0"}); errors.As(err, &te) {
+				return fmt.Errorf("field '%s': %w", fd.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldName 优先使用json标签里面的名字，返回给前端更友好
+func fieldName(fd reflect.StructField) string {
+	if name, _, _ := strings.Cut(fd.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return fd.Name
+}
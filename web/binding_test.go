@@ -0,0 +1,84 @@
+package web
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindUser struct {
+	ID    int64    `path:"id"`
+	Name  string   `json:"name" validate:"required,max=5"`
+	Age   int      `json:"age" validate:"min=18"`
+	Tags  []string `query:"tag"`
+	Token *string  `header:"X-Token"`
+}
+
+type bindAdmin struct {
+	Name string `json:"name"`
+}
+
+func (a *bindAdmin) Validate() error {
+	if a.Name != "admin" {
+		return errors.New("not admin")
+	}
+	return nil
+}
+
+func TestContext_Bind(t *testing.T) {
+	token := "abc"
+	testcase := []struct {
+		name    string
+		body    string
+		val     any
+		want    any
+		wantErr error
+	}{
+		{
+			name: "all",
+			body: `{"name":"ppp","age":18}`,
+			val:  &bindUser{},
+			want: &bindUser{ID: 123, Name: "ppp", Age: 18, Tags: []string{"a", "b"}, Token: &token},
+		},
+		{
+			name:    "validate",
+			body:    `{"name":"pppppp","age":10}`,
+			val:     &bindUser{},
+			wantErr: ValidationErrors{{Field: "name", Rule: "max", Param: "5"}, {Field: "age", Rule: "min", Param: "18"}},
+		},
+		{
+			name:    "required",
+			body:    `{"age":20}`,
+			val:     &bindUser{},
+			wantErr: ValidationErrors{{Field: "name", Rule: "required"}},
+		},
+		{
+			name:    "validator",
+			body:    `{"name":"ppp"}`,
+			val:     &bindAdmin{},
+			wantErr: errors.New("not admin"),
+		},
+		{
+			name:    "not pointer",
+			val:     bindUser{},
+			wantErr: errors.New("web: bind only supports pointer to struct"),
+		},
+	}
+
+	for _, tt := range testcase {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/user/123?tag=a&tag=b", strings.NewReader(tt.body))
+			request.Header.Set("X-Token", "abc")
+			c := &Context{Request: request, Params: map[string]string{"id": "123"}}
+			err := c.Bind(tt.val)
+			assert.Equal(t, tt.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tt.want, tt.val)
+		})
+	}
+}
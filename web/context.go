@@ -1,21 +1,45 @@
 package web
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type Context struct {
-	Request        *http.Request
-	Writer         http.ResponseWriter
-	Params         map[string]string
-	queryValues    url.Values
-	MatchedRoute   string
+	Request      *http.Request
+	Writer       http.ResponseWriter
+	Params       map[string]string
+	queryValues  url.Values
+	MatchedRoute string
+	// APIVersion 版本路由协商出来的版本，没有使用版本路由的时候为空
+	APIVersion     string
 	RespData       []byte
 	RespStatusCode int
+
+	// 请求级别的kv存储，中间件可以通过它向业务逻辑传递数据
+	keysMu sync.RWMutex
+	keys   map[string]any
+
+	// 是否已经中断了中间件链，Net 里面的步骤可能并发中断
+	aborted int32
+
+	// 业务逻辑返回的错误
+	err        error
+	errHandled bool
+
+	translator Translator
+	// 处理这个请求的server
+	server *httpServer
+	// 提前匹配到的路由
+	match      *matchInfo
+	matchedReq string
 }
 
 func (c *Context) BindJSON(val any) error {
@@ -65,9 +89,9 @@ func (s *StringValue) AsInt64() (int64, error) {
 	return strconv.ParseInt(s.Val, 10, 64)
 }
 
+// JSON 响应码在flushResp的时候统一写回去
 func (c *Context) JSON(status int, v any) {
 	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-	c.Writer.WriteHeader(status)
 	bytes, _ := json.Marshal(v)
 	c.RespData = bytes
 	c.RespStatusCode = status
@@ -76,3 +100,163 @@ func (c *Context) JSON(status int, v any) {
 func (c *Context) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(c.Writer, cookie)
 }
+
+// Set 往请求级别的存储中写入数据
+func (c *Context) Set(key string, val any) {
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+	if c.keys == nil {
+		c.keys = map[string]any{}
+	}
+	c.keys[key] = val
+}
+
+// Get 从请求级别的存储中读取数据
+func (c *Context) Get(key string) (any, bool) {
+	c.keysMu.RLock()
+	defer c.keysMu.RUnlock()
+	val, ok := c.keys[key]
+	return val, ok
+}
+
+// Keys 请求级别存储的所有数据，返回的是副本
+func (c *Context) Keys() map[string]any {
+	c.keysMu.RLock()
+	defer c.keysMu.RUnlock()
+	res := make(map[string]any, len(c.keys))
+	for k, v := range c.keys {
+		res[k] = v
+	}
+	return res
+}
+
+// MustGet 读取数据，key不存在的时候panic
+func (c *Context) MustGet(key string) any {
+	val, ok := c.Get(key)
+	if !ok {
+		panic(fmt.Sprintf("key '%s' does not exist", key))
+	}
+	return val
+}
+
+// Abort 中断中间件链，后面的中间件和业务逻辑都不会再执行
+// 已经在执行的外层中间件不受影响，可以通过 IsAborted 判断
+func (c *Context) Abort() {
+	atomic.StoreInt32(&c.aborted, 1)
+}
+
+// AbortWithStatus 中断并设置响应码
+func (c *Context) AbortWithStatus(status int) {
+	c.RespStatusCode = status
+	c.Abort()
+}
+
+// AbortWithJSON 中断并返回JSON
+func (c *Context) AbortWithJSON(status int, v any) {
+	c.JSON(status, v)
+	c.Abort()
+}
+
+// IsAborted 中间件链是否被中断
+func (c *Context) IsAborted() bool {
+	return atomic.LoadInt32(&c.aborted) == 1
+}
+
+// Error 记录错误，交给server的 ErrorHandler 统一处理
+func (c *Context) Error(err error) {
+	c.err = err
+	c.errHandled = false
+}
+
+// Err 业务逻辑记录的错误
+func (c *Context) Err() error {
+	return c.err
+}
+
+// CopyErr 复制 src 记录的错误和是否已经处理过，配合 Clone 使用，避免同一个错误被处理两次
+func (c *Context) CopyErr(src *Context) {
+	c.err = src.err
+	c.errHandled = src.errHandled
+}
+
+// AllowedMethods 请求的路径上注册了的所有method，CORS 的预检请求可以用它返回允许的method
+func (c *Context) AllowedMethods() []string {
+	if c.server == nil {
+		return nil
+	}
+	return c.server.loadRouter().allowedMethods(c.Request.URL.Path)
+}
+
+// Protocol 请求使用的协议，例如 HTTP/1.1、HTTP/2.0
+func (c *Context) Protocol() string {
+	return c.Request.Proto
+}
+
+// PeerCertificate 双向TLS里面已经验证过的客户端证书，没有的时候返回nil
+func (c *Context) PeerCertificate() *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return c.Request.TLS.VerifiedChains[0][0]
+}
+
+// Translator 把消息的key翻译成请求的语言，一般由 i18n 的中间件设置
+type Translator interface {
+	// T 找不到key的时候返回key本身
+	T(key string, args ...any) string
+}
+
+// SetTranslator 设置当前请求使用的 Translator
+func (c *Context) SetTranslator(t Translator) {
+	c.translator = t
+}
+
+// Translator 当前请求使用的 Translator，没有设置的时候返回nil
+func (c *Context) Translator() Translator {
+	return c.translator
+}
+
+// T 翻译消息，没有设置 Translator 的时候原样返回key
+func (c *Context) T(key string, args ...any) string {
+	if c.translator == nil {
+		return key
+	}
+	return c.translator.T(key, args...)
+}
+
+// Value 读取数据并转换成指定类型，key不存在或者类型不匹配的时候返回false
+func Value[T any](c *Context, key string) (T, bool) {
+	var zero T
+	val, ok := c.Get(key)
+	if !ok {
+		return zero, false
+	}
+	res, ok := val.(T)
+	if !ok {
+		return zero, false
+	}
+	return res, true
+}
+
+// Clone 复制一个 Context，让业务逻辑在另外的goroutine里面执行，例如超时控制
+// 存储的数据会被复制，两个 Context 互不影响，Writer 和 Request 使用参数
+// 需要用到未导出的匹配结果和server，所以放在这里；结果怎么合并回来由调用方决定
+func (c *Context) Clone(writer http.ResponseWriter, request *http.Request) *Context {
+	return &Context{
+		Request:        request,
+		Writer:         writer,
+		Params:         c.Params,
+		MatchedRoute:   c.MatchedRoute,
+		APIVersion:     c.APIVersion,
+		RespData:       c.RespData,
+		RespStatusCode: c.RespStatusCode,
+		keys:           c.Keys(),
+		aborted:        atomic.LoadInt32(&c.aborted),
+		err:            c.err,
+		errHandled:     c.errHandled,
+		translator:     c.translator,
+		server:         c.server,
+		match:          c.match,
+		matchedReq:     c.matchedReq,
+	}
+}
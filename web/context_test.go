@@ -0,0 +1,73 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestContext_Keys(t *testing.T) {
+	type User struct {
+		Name string
+	}
+
+	c := &Context{}
+	_, ok := c.Get("user")
+	assert.False(t, ok)
+	assert.Panics(t, func() { c.MustGet("user") })
+
+	c.Set("user", &User{Name: "ppp"})
+	c.Set("age", 18)
+
+	val, ok := c.Get("user")
+	assert.True(t, ok)
+	assert.Equal(t, &User{Name: "ppp"}, val)
+	assert.Equal(t, 18, c.MustGet("age"))
+
+	user, ok := Value[*User](c, "user")
+	assert.True(t, ok)
+	assert.Equal(t, "ppp", user.Name)
+
+	// 类型不匹配
+	_, ok = Value[string](c, "age")
+	assert.False(t, ok)
+	// key不存在
+	_, ok = Value[int](c, "unknown")
+	assert.False(t, ok)
+}
+
+// 在业务逻辑里面开goroutine读写
+func TestContext_KeysConcurrent(t *testing.T) {
+	c := &Context{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			c.Set("key", i)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = Value[int](c, "key")
+		}()
+	}
+	wg.Wait()
+	_, ok := Value[int](c, "key")
+	assert.True(t, ok)
+}
+
+func TestContext_Clone(t *testing.T) {
+	c := &Context{MatchedRoute: "/user/:id", RespData: []byte("origin")}
+	c.Set("user", "tom")
+
+	clone := c.Clone(nil, nil)
+	clone.Set("user", "jerry")
+	clone.RespData = []byte("clone")
+	clone.Error(NewHTTPError(400, ""))
+	clone.Abort()
+	assert.Equal(t, "/user/:id", clone.MatchedRoute)
+	assert.Equal(t, "tom", c.MustGet("user"))
+	assert.False(t, c.IsAborted())
+	assert.NoError(t, c.Err())
+	assert.Equal(t, map[string]any{"user": "jerry"}, clone.Keys())
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HandleFuncE 返回error的业务处理函数，通过 WrapE 转换成 HandleFunc
+type HandleFuncE func(c *Context) error
+
+// WrapE 把 HandleFuncE 转换成 HandleFunc，返回的error交给server的 ErrorHandler 处理
+func WrapE(handleFunc HandleFuncE) HandleFunc {
+	return func(c *Context) {
+		if err := handleFunc(c); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// HTTPError 带响应码的错误
+type HTTPError struct {
+	Code     int
+	Message  string
+	Internal error
+}
+
+func NewHTTPError(code int, msg string) *HTTPError {
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: msg}
+}
+
+// Wrap 包装底层错误，底层错误不会返回给前端
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	return &HTTPError{Code: e.Code, Message: e.Message, Internal: err}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Internal != nil {
+		return fmt.Sprintf("web: code=%d, message=%s, internal=%v", e.Code, e.Message, e.Internal)
+	}
+	return fmt.Sprintf("web: code=%d, message=%s", e.Code, e.Message)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Internal
+}
+
+// ErrorHandler 把业务逻辑返回的error转换成响应
+type ErrorHandler func(c *Context, err error)
+
+// DefaultErrorHandler 根据Accept的q值决定返回JSON还是纯文本，没有Accept的时候返回纯文本
+// 不是 HTTPError 的错误一律当作500，不把错误信息暴露给前端
+func DefaultErrorHandler(c *Context, err error) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		httpErr = NewHTTPError(http.StatusInternalServerError, "")
+	}
+
+	if prefersJSON(c.Request.Header.Get("Accept")) {
+		c.JSON(httpErr.Code, map[string]any{
+			"code":    httpErr.Code,
+			"message": httpErr.Message,
+		})
+		return
+	}
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	c.RespStatusCode = httpErr.Code
+	c.RespData = []byte(httpErr.Message)
+}
+
+// prefersJSON JSON的q值大于0并且不低于文本，application/problem+json 之类 +json 的类型也算JSON
+func prefersJSON(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return false
+	}
+	jsonQ, textQ := 0.0, 0.0
+	jsonSpec, textSpec := -1, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if val, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(val, 64); err != nil {
+				continue
+			}
+		}
+		typ, sub, _ := strings.Cut(mediaType, "/")
+		// 越具体的范围优先级越高：*/* 为0，application/* 为1，具体类型为2
+		switch {
+		case typ == "*":
+			jsonQ, jsonSpec = pick(jsonQ, jsonSpec, q, 0)
+			textQ, textSpec = pick(textQ, textSpec, q, 0)
+		case typ == "application" && sub == "*":
+			jsonQ, jsonSpec = pick(jsonQ, jsonSpec, q, 1)
+		case typ == "application" && (sub == "json" || strings.HasSuffix(sub, "+json")):
+			jsonQ, jsonSpec = pick(jsonQ, jsonSpec, q, 2)
+		case typ == "text" && sub == "*":
+			textQ, textSpec = pick(textQ, textSpec, q, 1)
+		case typ == "text":
+			textQ, textSpec = pick(textQ, textSpec, q, 2)
+		}
+	}
+	return jsonQ > 0 && jsonQ >= textQ
+}
+
+// pick 更具体的范围覆盖前面的q值，同样具体的取最大的q值
+func pick(q float64, spec int, newQ float64, newSpec int) (float64, int) {
+	if newSpec > spec || (newSpec == spec && newQ > q) {
+		return newQ, newSpec
+	}
+	return q, spec
+}
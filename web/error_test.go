@@ -0,0 +1,90 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	internal := errors.New("db error")
+	err := NewHTTPError(http.StatusNotFound, "user not found").Wrap(internal)
+	assert.Equal(t, "web: code=404, message=user not found, internal=db error", err.Error())
+	assert.True(t, errors.Is(err, internal))
+
+	err = NewHTTPError(http.StatusBadRequest, "")
+	assert.Equal(t, http.StatusText(http.StatusBadRequest), err.Message)
+}
+
+func TestServer_HandleFuncE(t *testing.T) {
+	s := NewHttpServer()
+	s.Get("/user", WrapE(func(c *Context) error {
+		return fmt.Errorf("find user: %w", NewHTTPError(http.StatusNotFound, "user not found"))
+	}))
+	s.Get("/panic", WrapE(func(c *Context) error {
+		return errors.New("db error")
+	}))
+	s.Get("/ok", WrapE(func(c *Context) error {
+		c.JSON(http.StatusOK, "ok")
+		return nil
+	}))
+
+	testcase := []struct {
+		name     string
+		path     string
+		accept   string
+		wantCode int
+		wantBody string
+	}{
+		{name: "json", path: "/user", accept: "application/json", wantCode: 404, wantBody: `{"code":404,"message":"user not found"}`},
+		{name: "text", path: "/user", accept: "text/html", wantCode: 404, wantBody: "user not found"},
+		{name: "json refused", path: "/user", accept: "application/json;q=0, text/plain", wantCode: 404, wantBody: "user not found"},
+		{name: "problem json", path: "/user", accept: "application/problem+json", wantCode: 404, wantBody: `{"code":404,"message":"user not found"}`},
+		{name: "any", path: "/user", accept: "*/*", wantCode: 404, wantBody: `{"code":404,"message":"user not found"}`},
+		{name: "browser", path: "/user", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", wantCode: 404, wantBody: "user not found"},
+		{name: "json preferred", path: "/user", accept: "text/plain;q=0.5, application/*", wantCode: 404, wantBody: `{"code":404,"message":"user not found"}`},
+		{name: "text preferred", path: "/user", accept: "application/json;q=0.5, text/*", wantCode: 404, wantBody: "user not found"},
+		{name: "internal error", path: "/panic", wantCode: 500, wantBody: "Internal Server Error"},
+		{name: "no error", path: "/ok", wantCode: 200, wantBody: `"ok"`},
+	}
+
+	for _, tt := range testcase {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			request.Header.Set("Accept", tt.accept)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, request)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			assert.Equal(t, tt.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestServer_WithErrorHandler(t *testing.T) {
+	var statusInMiddleware int
+	s := NewHttpServer(
+		WithErrorHandler(func(c *Context, err error) {
+			c.RespStatusCode = http.StatusTeapot
+			c.RespData = []byte(err.Error())
+		}),
+		WithMiddleware(func(next HandleFunc) HandleFunc {
+			return func(c *Context) {
+				next(c)
+				statusInMiddleware = c.RespStatusCode
+			}
+		}),
+	)
+	s.Get("/user", WrapE(func(c *Context) error {
+		return errors.New("oops")
+	}))
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+	assert.Equal(t, "oops", recorder.Body.String())
+	// server级别的中间件能看到错误处理之后的响应码
+	assert.Equal(t, http.StatusTeapot, statusInMiddleware)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group 路由分组，组内的路由共享前缀、中间件和文档标签
+type Group struct {
+	server      *httpServer
+	prefix      string
+	middlewares []Middleware
+	tags        []string
+}
+
+// Group 创建路由分组，prefix 必须以 / 开始并且结尾不能有 /
+func (h *httpServer) Group(prefix string, middlewares ...Middleware) *Group {
+	isValidPath(prefix)
+	return &Group{
+		server:      h,
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		middlewares: middlewares,
+	}
+}
+
+// Group 创建子分组，继承父分组的中间件和标签
+func (g *Group) Group(prefix string, middlewares ...Middleware) *Group {
+	isValidPath(prefix)
+	return &Group{
+		server:      g.server,
+		prefix:      g.prefix + strings.TrimSuffix(prefix, "/"),
+		middlewares: append(append([]Middleware{}, g.middlewares...), middlewares...),
+		tags:        append([]string{}, g.tags...),
+	}
+}
+
+// Use 给分组添加中间件，只对之后注册的路由生效
+func (g *Group) Use(middlewares ...Middleware) *Group {
+	g.middlewares = append(g.middlewares, middlewares...)
+	return g
+}
+
+// UseIntercept 给分组添加拦截器，和分组的中间件按照添加的顺序执行
+func (g *Group) UseIntercept(intercepts ...Intercept) *Group {
+	return g.Use(interceptMiddlewares(intercepts)...)
+}
+
+// Tags 设置分组的文档标签
+func (g *Group) Tags(tags ...string) *Group {
+	g.tags = append(g.tags, tags...)
+	return g
+}
+
+// Handle 在分组内注册路由，分组的中间件在路由中间件之后、业务逻辑之前执行
+func (g *Group) Handle(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	isValidPath(path)
+	fullPath := g.prefix + path
+	if path == "/" {
+		fullPath = g.prefix
+	}
+	if fullPath == "" {
+		fullPath = "/"
+	}
+	if len(g.middlewares) > 0 {
+		handleFunc = buildChain(handleFunc, g.middlewares)
+	}
+	if len(g.tags) > 0 {
+		opts = append([]RouteOption{WithTags(g.tags...)}, opts...)
+	}
+	g.server.addRoute(httpMethod, fullPath, handleFunc, opts...)
+}
+
+func (g *Group) Get(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodGet, path, handleFunc, opts...)
+}
+
+func (g *Group) Post(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodPost, path, handleFunc, opts...)
+}
+
+func (g *Group) Put(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodPut, path, handleFunc, opts...)
+}
+
+func (g *Group) Patch(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodPatch, path, handleFunc, opts...)
+}
+
+func (g *Group) Delete(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodDelete, path, handleFunc, opts...)
+}
+
+func (g *Group) Options(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodOptions, path, handleFunc, opts...)
+}
+
+func (g *Group) Head(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	g.Handle(http.MethodHead, path, handleFunc, opts...)
+}
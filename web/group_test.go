@@ -0,0 +1,49 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	actual := []string{}
+	md := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(c *Context) {
+				actual = append(actual, name)
+				next(c)
+			}
+		}
+	}
+
+	s := NewHttpServer()
+	api := s.Group("/api", md("api")).Tags("api")
+	v1 := api.Group("/v1", md("v1")).Tags("v1")
+	v1.Get("/user/:id", func(c *Context) {
+		actual = append(actual, "handler")
+		c.RespData = []byte(c.MatchedRoute)
+	}, WithSummary("get user"))
+	api.Get("/", func(c *Context) {
+		c.RespData = []byte("api root")
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/user/1", nil))
+	assert.Equal(t, "/api/v1/user/:id", recorder.Body.String())
+	assert.Equal(t, []string{"api", "v1", "handler"}, actual)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(t, "api root", recorder.Body.String())
+
+	matched, ok := s.findRoute(http.MethodGet, "/api/v1/user/1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"api", "v1"}, matched.meta.tags)
+	assert.Equal(t, "get user", matched.meta.summary)
+
+	assert.Panics(t, func() {
+		s.Group("api")
+	})
+}
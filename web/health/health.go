@@ -0,0 +1,229 @@
+package health
+
+import (
+	"WebFramework/web"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultTimeout = 3 * time.Second
+
+// Checker 健康检查
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc 函数形式的健康检查
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Pinger 能够ping的资源，例如 *sql.DB 和 *orm.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingChecker 通过ping检查资源是否可用
+func PingChecker(p Pinger) Checker {
+	return CheckerFunc(p.PingContext)
+}
+
+// Router 可以挂载健康检查路由的server，web.NewHttpServer 返回的server满足这个接口
+type Router interface {
+	Get(path string, handleFunc web.HandleFunc, opts ...web.RouteOption)
+}
+
+// Lifecycle 可以通知开始关闭的server
+type Lifecycle interface {
+	RegisterOnShutdown(fn func())
+}
+
+var errShuttingDown = errors.New("server is shutting down")
+
+type check struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+}
+
+// Health 存活检查 /healthz 和就绪检查 /readyz
+// - 所有检查并发执行，单个检查超时算失败
+// - 开始关闭之后就绪检查自动失败
+type Health struct {
+	mu        sync.RWMutex
+	liveness  []check
+	readiness []check
+	timeout   time.Duration
+
+	shuttingDown int32
+}
+
+func New() *Health {
+	return &Health{timeout: defaultTimeout}
+}
+
+// Timeout 没有单独设置超时时间的检查使用的超时时间，默认3秒
+func (h *Health) Timeout(timeout time.Duration) *Health {
+	h.timeout = timeout
+	return h
+}
+
+// AddLiveness 添加存活检查，存活检查失败说明进程需要重启，只应该检查进程本身
+func (h *Health) AddLiveness(name string, checker Checker) *Health {
+	return h.AddLivenessWithTimeout(name, checker, 0)
+}
+
+func (h *Health) AddLivenessWithTimeout(name string, checker Checker, timeout time.Duration) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, check{name: name, checker: checker, timeout: timeout})
+	return h
+}
+
+// AddReadiness 添加就绪检查，例如数据库和下游依赖
+func (h *Health) AddReadiness(name string, checker Checker) *Health {
+	return h.AddReadinessWithTimeout(name, checker, 0)
+}
+
+func (h *Health) AddReadinessWithTimeout(name string, checker Checker, timeout time.Duration) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, check{name: name, checker: checker, timeout: timeout})
+	return h
+}
+
+// MarkShuttingDown 让就绪检查失败
+func (h *Health) MarkShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// Watch 在server开始关闭的时候让就绪检查失败
+// 健康检查挂载在单独的管理端口上的时候，用这个方法关联业务server
+func (h *Health) Watch(l Lifecycle) *Health {
+	l.RegisterOnShutdown(h.MarkShuttingDown)
+	return h
+}
+
+// Mount 注册 /healthz 和 /readyz，如果 r 是 Lifecycle 会自动 Watch
+func (h *Health) Mount(r Router) {
+	r.Get("/healthz", h.LivenessHandler(), web.WithHidden())
+	r.Get("/readyz", h.ReadinessHandler(), web.WithHidden())
+	if l, ok := r.(Lifecycle); ok {
+		h.Watch(l)
+	}
+}
+
+func (h *Health) LivenessHandler() web.HandleFunc {
+	return func(c *web.Context) {
+		h.mu.RLock()
+		checks := h.liveness
+		h.mu.RUnlock()
+		h.respond(c, h.run(c.Request.Context(), checks), false)
+	}
+}
+
+func (h *Health) ReadinessHandler() web.HandleFunc {
+	return func(c *web.Context) {
+		h.mu.RLock()
+		checks := h.readiness
+		h.mu.RUnlock()
+		shuttingDown := atomic.LoadInt32(&h.shuttingDown) == 1
+		h.respond(c, h.run(c.Request.Context(), checks), shuttingDown)
+	}
+}
+
+// Result 单个检查的结果
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report 返回给调用方的JSON
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+func (h *Health) respond(c *web.Context, results map[string]Result, shuttingDown bool) {
+	report := Report{Status: statusOK, Checks: results}
+	for _, res := range results {
+		if res.Status != statusOK {
+			report.Status = statusFail
+		}
+	}
+	if shuttingDown {
+		report.Status = statusFail
+		report.Checks["shutdown"] = Result{Status: statusFail, Error: errShuttingDown.Error()}
+	}
+	code := http.StatusOK
+	if report.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.Writer.Header().Set("Cache-Control", "no-store")
+	c.JSON(code, report)
+}
+
+// run 并发执行所有检查
+func (h *Health) run(ctx context.Context, checks []check) map[string]Result {
+	res := make(map[string]Result, len(checks))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, ck := range checks {
+		wg.Add(1)
+		go func(ck check) {
+			defer wg.Done()
+			r := h.runOne(ctx, ck)
+			mu.Lock()
+			res[ck.name] = r
+			mu.Unlock()
+		}(ck)
+	}
+	wg.Wait()
+	return res
+}
+
+func (h *Health) runOne(ctx context.Context, ck check) Result {
+	timeout := ck.timeout
+	if timeout <= 0 {
+		timeout = h.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- errors.New("check panic")
+			}
+		}()
+		errCh <- ck.checker.Check(ctx)
+	}()
+
+	var err error
+	// 检查没有处理ctx的时候也不会一直阻塞
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := Result{Status: statusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = statusFail
+		res.Error = err.Error()
+	}
+	return res
+}
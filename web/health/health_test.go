@@ -0,0 +1,64 @@
+package health
+
+import (
+	"WebFramework/web"
+	"WebFramework/web/webtest"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type mockPinger struct {
+	err error
+}
+
+func (m mockPinger) PingContext(ctx context.Context) error {
+	return m.err
+}
+
+func TestHealth(t *testing.T) {
+	s := web.NewHttpServer()
+	h := New().Timeout(50 * time.Millisecond).
+		AddLiveness("goroutine", CheckerFunc(func(ctx context.Context) error { return nil })).
+		AddReadiness("db", PingChecker(mockPinger{}))
+	h.Mount(s)
+	client := webtest.New(t, s)
+
+	client.Get("/healthz").Expect().
+		Status(http.StatusOK).
+		JSONPath("$.status", "ok").
+		JSONPath("$.checks.goroutine.status", "ok")
+	client.Get("/readyz").Expect().
+		Status(http.StatusOK).
+		JSONPath("$.checks.db.status", "ok")
+
+	// 检查失败和超时，并发执行
+	h.AddReadiness("cache", PingChecker(mockPinger{err: errors.New("connection refused")})).
+		AddReadinessWithTimeout("slow", CheckerFunc(func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}), 10*time.Millisecond).
+		AddReadiness("block", CheckerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+	start := time.Now()
+	client.Get("/readyz").Expect().
+		Status(http.StatusServiceUnavailable).
+		JSONPath("$.status", "fail").
+		JSONPath("$.checks.db.status", "ok").
+		JSONPath("$.checks.cache.error", "connection refused").
+		JSONPath("$.checks.slow.error", "context deadline exceeded").
+		JSONPath("$.checks.block.status", "fail")
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	// 开始关闭之后就绪检查失败，存活检查不受影响
+	assert.NoError(t, s.Shutdown(context.Background()))
+	client.Get("/readyz").Expect().
+		Status(http.StatusServiceUnavailable).
+		JSONPath("$.checks.shutdown.error", "server is shutting down")
+	client.Get("/healthz").Expect().Status(http.StatusOK)
+}
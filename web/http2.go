@@ -0,0 +1,54 @@
+package web
+
+import (
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"time"
+)
+
+// HTTP2Config HTTP/2的参数，0表示使用 golang.org/x/net/http2 的默认值
+type HTTP2Config struct {
+	// MaxConcurrentStreams 每个连接上同时处理的请求数
+	MaxConcurrentStreams uint32
+	// MaxReadFrameSize 读取的帧的最大长度，范围是16K到16M
+	MaxReadFrameSize uint32
+	// IdleTimeout 连接空闲多久之后关闭
+	IdleTimeout time.Duration
+}
+
+// WithHTTP2 设置HTTP/2的参数，StartTLS 和 h2c 都生效
+func WithHTTP2(cfg HTTP2Config) HttpServerOption {
+	return func(server *httpServer) {
+		server.http2Config = &cfg
+	}
+}
+
+// WithH2C 不使用TLS的时候也支持HTTP/2，包括直接以HTTP/2连接和通过 Upgrade: h2c 升级
+// 只应该用在内网，公网上的客户端一般只通过TLS使用HTTP/2
+func WithH2C() HttpServerOption {
+	return func(server *httpServer) {
+		server.h2c = true
+	}
+}
+
+// configureHTTP2 根据HTTP/2的配置设置 http.Server
+func (h *httpServer) configureHTTP2(srv *http.Server) error {
+	if h.http2Config == nil && !h.h2c {
+		return nil
+	}
+	h2s := &http2.Server{}
+	if cfg := h.http2Config; cfg != nil {
+		h2s.MaxConcurrentStreams = cfg.MaxConcurrentStreams
+		h2s.MaxReadFrameSize = cfg.MaxReadFrameSize
+		h2s.IdleTimeout = cfg.IdleTimeout
+	}
+	// 设置 TLSNextProto，TLS连接通过ALPN协商出h2之后使用这里的参数
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	if h.h2c {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func startForTest(t *testing.T, s *httpServer, start func() error) string {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- start()
+	}()
+	require.Eventually(t, func() bool {
+		return len(s.Addrs()) > 0
+	}, time.Second, time.Millisecond)
+	t.Cleanup(func() {
+		assert.NoError(t, s.Shutdown(context.Background()))
+		assert.Equal(t, http.ErrServerClosed, <-errCh)
+	})
+	return s.Addrs()[0].String()
+}
+
+func protocolHandler(c *Context) {
+	c.RespStatusCode = http.StatusOK
+	c.RespData = []byte(c.Protocol())
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestServer_H2C(t *testing.T) {
+	s := NewHttpServer(WithH2C(), WithHTTP2(HTTP2Config{MaxConcurrentStreams: 10, IdleTimeout: time.Second}))
+	s.Get("/proto", protocolHandler)
+	addr := startForTest(t, s, func() error {
+		return s.Start("127.0.0.1:0")
+	})
+
+	// 直接以HTTP/2连接
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp, err := h2cClient.Get("http://" + addr + "/proto")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readBody(t, resp))
+
+	// HTTP/1.1 仍然可以使用
+	resp, err = http.Get("http://" + addr + "/proto")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", readBody(t, resp))
+}
+
+func TestServer_HTTP2OverTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	s := NewHttpServer(WithHTTP2(HTTP2Config{MaxConcurrentStreams: 10}))
+	s.Get("/proto", protocolHandler)
+	addr := startForTest(t, s, func() error {
+		return s.StartTLS("127.0.0.1:0", certFile, keyFile)
+	})
+
+	cli := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := cli.Get("https://" + addr + "/proto")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readBody(t, resp))
+}
@@ -0,0 +1,224 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Bundle 所有语言的消息
+// 消息文件的格式：
+//
+//	{
+//	  "hello": "Hello, {name}",
+//	  "user": {"title": "User"},
+//	  "apples": {"one": "{count} apple", "other": "{count} apples"}
+//	}
+//
+// 嵌套的对象展开成 user.title 这样的key，只包含复数类别的对象是复数消息
+type Bundle struct {
+	mu       sync.RWMutex
+	fallback string
+	// 语言 -> key -> 复数类别 -> 消息，普通消息只有 other
+	messages map[string]map[string]map[string]string
+	plurals  map[string]PluralRule
+}
+
+// NewBundle fallback 是请求的语言都不支持的时候使用的语言
+func NewBundle(fallback string) *Bundle {
+	return &Bundle{
+		fallback: normalizeLang(fallback),
+		messages: map[string]map[string]map[string]string{},
+		plurals:  map[string]PluralRule{},
+	}
+}
+
+// PluralRule 设置语言的复数规则，覆盖内置的规则
+func (b *Bundle) PluralRule(lang string, rule PluralRule) *Bundle {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.plurals[normalizeLang(lang)] = rule
+	return b
+}
+
+// AddMessages 添加消息，已经存在的key会被覆盖
+func (b *Bundle) AddMessages(lang string, messages map[string]any) error {
+	flat := map[string]map[string]string{}
+	if err := flatten("", messages, flat); err != nil {
+		return fmt.Errorf("i18n: lang '%s': %w", lang, err)
+	}
+	lang = normalizeLang(lang)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.messages[lang] == nil {
+		b.messages[lang] = map[string]map[string]string{}
+	}
+	for k, v := range flat {
+		b.messages[lang][k] = v
+	}
+	return nil
+}
+
+// Parse 解析JSON或者TOML格式的消息，format 是 json 或者 toml
+func (b *Bundle) Parse(lang, format string, data []byte) error {
+	messages := map[string]any{}
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		err = json.Unmarshal(data, &messages)
+	case "toml":
+		err = toml.Unmarshal(data, &messages)
+	default:
+		return fmt.Errorf("i18n: unsupported format '%s'", format)
+	}
+	if err != nil {
+		return fmt.Errorf("i18n: lang '%s': %w", lang, err)
+	}
+	return b.AddMessages(lang, messages)
+}
+
+// LoadFile 加载消息文件，文件名是语言，扩展名是格式，例如 zh-CN.json、en.toml
+func (b *Bundle) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lang, format := parseFileName(path)
+	return b.Parse(lang, format, data)
+}
+
+// LoadFS 加载 fs.FS 里面所有匹配 pattern 的消息文件，可以配合 embed 使用
+func (b *Bundle) LoadFS(fsys fs.FS, pattern string) error {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		lang, format := parseFileName(path)
+		if err = b.Parse(lang, format, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Languages 所有加载了消息的语言
+func (b *Bundle) Languages() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := make([]string, 0, len(b.messages))
+	for lang := range b.messages {
+		res = append(res, lang)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Localizer 按照顺序选择第一个支持的语言，zh-CN 不支持的时候会尝试 zh
+// 都不支持的时候使用 fallback
+func (b *Bundle) Localizer(langs ...string) *Localizer {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, lang := range langs {
+		lang = normalizeLang(lang)
+		if _, ok := b.messages[lang]; ok {
+			return &Localizer{bundle: b, lang: lang}
+		}
+		if base := baseLang(lang); base != lang {
+			if _, ok := b.messages[base]; ok {
+				return &Localizer{bundle: b, lang: base}
+			}
+		}
+	}
+	return &Localizer{bundle: b, lang: b.fallback}
+}
+
+// lookup 依次查找语言、基础语言和 fallback
+func (b *Bundle) lookup(lang, key string) (map[string]string, string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, l := range []string{lang, baseLang(lang), b.fallback} {
+		if msg, ok := b.messages[l][key]; ok {
+			return msg, l, true
+		}
+	}
+	return nil, "", false
+}
+
+func (b *Bundle) pluralRule(lang string) PluralRule {
+	b.mu.RLock()
+	rule, ok := b.plurals[lang]
+	if !ok {
+		rule, ok = b.plurals[baseLang(lang)]
+	}
+	b.mu.RUnlock()
+	if ok {
+		return rule
+	}
+	return builtinPluralRule(baseLang(lang))
+}
+
+func flatten(prefix string, src map[string]any, dst map[string]map[string]string) error {
+	for k, v := range src {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case string:
+			dst[key] = map[string]string{Other: val}
+		case map[string]any:
+			if forms, ok := pluralForms(val); ok {
+				dst[key] = forms
+				continue
+			}
+			if err := flatten(key, val, dst); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("key '%s' has unsupported value %v", key, v)
+		}
+	}
+	return nil
+}
+
+// pluralForms 所有的key都是复数类别并且包含 other 的对象是复数消息
+func pluralForms(m map[string]any) (map[string]string, bool) {
+	if _, ok := m[Other]; !ok {
+		return nil, false
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok || !isPluralCategory(k) {
+			return nil, false
+		}
+		res[k] = s
+	}
+	return res, true
+}
+
+func parseFileName(path string) (string, string) {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(filepath.Base(path), ext), strings.TrimPrefix(ext, ".")
+}
+
+// normalizeLang zh_CN、ZH-cn 都转换成 zh-cn
+func normalizeLang(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+func baseLang(lang string) string {
+	base, _, _ := strings.Cut(lang, "-")
+	return base
+}
@@ -0,0 +1,141 @@
+package i18n
+
+import (
+	"WebFramework/web"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestBundle(t *testing.T) *Bundle {
+	fsys := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{
+			"hello": "Hello, {name}",
+			"user": {"title": "User"},
+			"apples": {"one": "{count} apple", "other": "{count} apples"},
+			"validation": {"required": "{field} is required", "min": "{field} must be at least {param}"}
+		}`)},
+		"locales/zh-CN.toml": {Data: []byte(`
+hello = "你好，{name}"
+apples = { other = "{count}个苹果" }
+
+[validation]
+required = "{field}不能为空"
+`)},
+		"locales/ru.json": {Data: []byte(`{"files": {"one": "{count} файл", "few": "{count} файла", "many": "{count} файлов", "other": "{count} файла"}}`)},
+	}
+	b := NewBundle("en")
+	require.NoError(t, b.LoadFS(fsys, "locales/*"))
+	return b
+}
+
+func TestBundle(t *testing.T) {
+	b := newTestBundle(t)
+	assert.Equal(t, []string{"en", "ru", "zh-cn"}, b.Languages())
+
+	testCases := []struct {
+		name  string
+		langs []string
+		key   string
+		args  []any
+		want  string
+	}{
+		{name: "interpolate", langs: []string{"en"}, key: "hello", args: []any{"name", "Tom"}, want: "Hello, Tom"},
+		{name: "map args", langs: []string{"zh-CN"}, key: "hello", args: []any{map[string]any{"name": "汤姆"}}, want: "你好，汤姆"},
+		{name: "nested", langs: []string{"en"}, key: "user.title", want: "User"},
+		{name: "fallback key", langs: []string{"zh_CN"}, key: "user.title", want: "User"},
+		{name: "base lang", langs: []string{"ru-RU"}, key: "files", args: []any{"count", 1}, want: "1 файл"},
+		{name: "unsupported lang", langs: []string{"de"}, key: "hello", args: []any{"name", "Tom"}, want: "Hello, Tom"},
+		{name: "missing key", langs: []string{"en"}, key: "missing", want: "missing"},
+		{name: "missing param", langs: []string{"en"}, key: "hello", want: "Hello, {name}"},
+		{name: "plural one", langs: []string{"en"}, key: "apples", args: []any{"count", 1}, want: "1 apple"},
+		{name: "plural other", langs: []string{"en"}, key: "apples", args: []any{"count", 3}, want: "3 apples"},
+		{name: "plural zh", langs: []string{"zh-CN"}, key: "apples", args: []any{"count", 1}, want: "1个苹果"},
+		{name: "plural ru few", langs: []string{"ru"}, key: "files", args: []any{"count", 23}, want: "23 файла"},
+		{name: "plural ru many", langs: []string{"ru"}, key: "files", args: []any{"count", 11}, want: "11 файлов"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, b.Localizer(tc.langs...).T(tc.key, tc.args...))
+		})
+	}
+
+	b.PluralRule("en", func(n float64) string { return Other })
+	assert.Equal(t, "1 apples", b.Localizer("en").T("apples", "count", 1))
+
+	assert.Error(t, b.Parse("en", "yaml", nil))
+	assert.Error(t, b.AddMessages("en", map[string]any{"bad": 1}))
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"fr-CH", "fr", "en", "de"},
+		ParseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5"))
+	assert.Equal(t, []string{"en", "zh"}, ParseAcceptLanguage("zh;q=0.5, ja;q=0, en"))
+	assert.Empty(t, ParseAcceptLanguage(""))
+}
+
+func TestMiddleware(t *testing.T) {
+	type signUp struct {
+		Name string `json:"name" validate:"required"`
+	}
+	s := web.NewHttpServer(web.WithMiddleware(NewBuilder(newTestBundle(t)).Build()))
+	s.Get("/hello", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte(c.T("hello", "name", "Tom"))
+	})
+	s.Post("/sign-up", web.Typed(func(ctx context.Context, req signUp) (string, error) {
+		return "ok", nil
+	}))
+
+	testCases := []struct {
+		name     string
+		target   string
+		cookie   string
+		accept   string
+		wantLang string
+		wantBody string
+	}{
+		{name: "default", target: "/hello", wantLang: "en", wantBody: "Hello, Tom"},
+		{name: "accept language", target: "/hello", accept: "de, zh-CN;q=0.8, en;q=0.5", wantLang: "zh-cn", wantBody: "你好，Tom"},
+		{name: "cookie", target: "/hello", cookie: "zh-CN", accept: "en", wantLang: "zh-cn", wantBody: "你好，Tom"},
+		{name: "query", target: "/hello?lang=en", cookie: "zh-CN", wantLang: "en", wantBody: "Hello, Tom"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "lang", Value: tc.cookie})
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept-Language", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantLang, recorder.Header().Get("Content-Language"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+
+	// 校验错误的信息
+	req := httptest.NewRequest(http.MethodPost, "/sign-up", strings.NewReader(`{}`))
+	req.Header.Set("Accept-Language", "zh-CN")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "name不能为空")
+}
+
+func TestFuncMap(t *testing.T) {
+	l := newTestBundle(t).Localizer("en")
+	tpl := template.Must(template.New("page").Funcs(FuncMap(l)).Parse(`<h1>{{T "hello" "name" .}}</h1>`))
+	buf := &bytes.Buffer{}
+	require.NoError(t, tpl.Execute(buf, "<Tom>"))
+	assert.Equal(t, "<h1>Hello, &lt;Tom&gt;</h1>", buf.String())
+}
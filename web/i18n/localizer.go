@@ -0,0 +1,120 @@
+package i18n
+
+import (
+	"WebFramework/web"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// Localizer 某个语言的翻译，实现了 web.Translator
+type Localizer struct {
+	bundle *Bundle
+	lang   string
+}
+
+// Lang 选中的语言
+func (l *Localizer) Lang() string {
+	return l.lang
+}
+
+// T 翻译消息，args 是交替的参数名和值，或者一个 map[string]any
+// - 消息里面的 {name} 会被替换成参数的值
+// - 复数消息根据 count 参数选择类别，没有对应类别的时候使用 other
+// - 找不到key的时候返回key本身
+func (l *Localizer) T(key string, args ...any) string {
+	forms, lang, ok := l.bundle.lookup(l.lang, key)
+	if !ok {
+		return key
+	}
+	params := toParams(args)
+	msg := forms[Other]
+	if len(forms) > 1 {
+		if n, ok := toFloat(params["count"]); ok {
+			if form, ok := forms[l.bundle.pluralRule(lang)(n)]; ok {
+				msg = form
+			}
+		}
+	}
+	return interpolate(msg, params)
+}
+
+// FuncMap 在模板里面使用 {{T "hello" "name" .Name}}
+func FuncMap(t web.Translator) template.FuncMap {
+	return template.FuncMap{"T": t.T}
+}
+
+func toParams(args []any) map[string]any {
+	if len(args) == 1 {
+		if m, ok := args[0].(map[string]any); ok {
+			return m
+		}
+	}
+	res := make(map[string]any, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		res[fmt.Sprint(args[i])] = args[i+1]
+	}
+	return res
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// interpolate 替换 {name}，没有对应参数的占位符保持原样
+func interpolate(msg string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(msg, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(msg[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		sb.WriteString(msg[:start])
+		if v, ok := params[msg[start+1:end]]; ok {
+			sb.WriteString(fmt.Sprint(v))
+		} else {
+			sb.WriteString(msg[start : end+1])
+		}
+		msg = msg[end+1:]
+	}
+	sb.WriteString(msg)
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package i18n
+
+import (
+	"WebFramework/web"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type MiddlewareBuilder struct {
+	bundle     *Bundle
+	queryParam string
+	cookieName string
+}
+
+// NewBuilder 依次从查询参数、cookie 和 Accept-Language 里面选择语言，默认的参数名和cookie名都是 lang
+func NewBuilder(bundle *Bundle) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		bundle:     bundle,
+		queryParam: "lang",
+		cookieName: "lang",
+	}
+}
+
+// QueryParam 设置查询参数的名字，空字符串表示不从查询参数读取
+func (m *MiddlewareBuilder) QueryParam(name string) *MiddlewareBuilder {
+	m.queryParam = name
+	return m
+}
+
+// Cookie 设置cookie的名字，空字符串表示不从cookie读取
+func (m *MiddlewareBuilder) Cookie(name string) *MiddlewareBuilder {
+	m.cookieName = name
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			langs := make([]string, 0, 4)
+			if m.queryParam != "" {
+				if lang := c.Request.URL.Query().Get(m.queryParam); lang != "" {
+					langs = append(langs, lang)
+				}
+			}
+			if m.cookieName != "" {
+				if cookie, err := c.Request.Cookie(m.cookieName); err == nil && cookie.Value != "" {
+					langs = append(langs, cookie.Value)
+				}
+			}
+			langs = append(langs, ParseAcceptLanguage(c.Request.Header.Get("Accept-Language"))...)
+
+			l := m.bundle.Localizer(langs...)
+			c.SetTranslator(l)
+			c.Writer.Header().Set("Content-Language", l.Lang())
+			next(c)
+		}
+	}
+}
+
+// ParseAcceptLanguage 按照q值从高到低返回语言，q=0和*会被忽略
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	list := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if k != "q" {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				f = 0
+			}
+			q = f
+		}
+		if q <= 0 {
+			continue
+		}
+		list = append(list, weighted{lang: lang, q: q})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+	res := make([]string, 0, len(list))
+	for _, w := range list {
+		res = append(res, w.lang)
+	}
+	return res
+}
@@ -0,0 +1,94 @@
+package i18n
+
+import "math"
+
+// CLDR 的复数类别
+const (
+	Zero  = "zero"
+	One   = "one"
+	Two   = "two"
+	Few   = "few"
+	Many  = "many"
+	Other = "other"
+)
+
+// PluralRule 根据数量返回复数类别
+type PluralRule func(n float64) string
+
+func isPluralCategory(s string) bool {
+	switch s {
+	case Zero, One, Two, Few, Many, Other:
+		return true
+	}
+	return false
+}
+
+// builtinPluralRule 常用语言的整数复数规则，没有内置的语言按照英语处理
+func builtinPluralRule(lang string) PluralRule {
+	switch lang {
+	case "zh", "ja", "ko", "vi", "th", "id", "ms":
+		return func(n float64) string { return Other }
+	case "fr", "pt":
+		return func(n float64) string {
+			if n >= 0 && n < 2 {
+				return One
+			}
+			return Other
+		}
+	case "ru", "uk", "be":
+		return slavicRule(false)
+	case "pl":
+		return slavicRule(true)
+	case "ar":
+		return arabicRule
+	default:
+		return func(n float64) string {
+			if n == 1 {
+				return One
+			}
+			return Other
+		}
+	}
+}
+
+// slavicRule 俄语和波兰语的区别在于波兰语只有1是 one
+func slavicRule(onlyOne bool) PluralRule {
+	return func(n float64) string {
+		if n != math.Trunc(n) {
+			return Other
+		}
+		i := int64(math.Abs(n))
+		mod10, mod100 := i%10, i%100
+		switch {
+		case onlyOne && i == 1:
+			return One
+		case !onlyOne && mod10 == 1 && mod100 != 11:
+			return One
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return Few
+		default:
+			return Many
+		}
+	}
+}
+
+func arabicRule(n float64) string {
+	if n != math.Trunc(n) {
+		return Other
+	}
+	i := int64(math.Abs(n))
+	switch mod100 := i % 100; {
+	case i == 0:
+		return Zero
+	case i == 1:
+		return One
+	case i == 2:
+		return Two
+	case mod100 >= 3 && mod100 <= 10:
+		return Few
+	case mod100 >= 11:
+		return Many
+	default:
+		return Other
+	}
+}
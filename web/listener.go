@@ -0,0 +1,220 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 一个监听和只对它生效的中间件
+type listener struct {
+	net.Listener
+	middlewares []Middleware
+}
+
+// Listen 添加监听，调用 Serve 之后开始处理请求
+// middlewares 只对这个监听上的请求生效，在server级别的中间件之后执行
+func (h *httpServer) Listen(l net.Listener, middlewares ...Middleware) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, listener{Listener: l, middlewares: middlewares})
+}
+
+// ListenTCP 监听TCP地址
+func (h *httpServer) ListenTCP(addr string, middlewares ...Middleware) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	h.Listen(l, middlewares...)
+	return nil
+}
+
+// ListenUnix 监听Unix域套接字，已经存在的套接字文件会被删除，关闭的时候删除套接字文件
+// perm 为0的时候不修改文件权限
+func (h *httpServer) ListenUnix(path string, perm os.FileMode, middlewares ...Middleware) error {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("web: '%s' exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if perm != 0 {
+		if err = os.Chmod(path, perm); err != nil {
+			_ = l.Close()
+			return err
+		}
+	}
+	h.Listen(l, middlewares...)
+	return nil
+}
+
+// 第一个继承的文件描述符，0 1 2 是标准输入输出
+var listenFDsStart = 3
+
+// ListenSystemd 使用 systemd 通过 LISTEN_FDS 传递进来的套接字，返回监听的个数
+// 读取之后会清除 LISTEN_PID、LISTEN_FDS 和 LISTEN_FDNAMES，避免子进程重复使用
+func (h *httpServer) ListenSystemd(middlewares ...Middleware) (int, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0, errors.New("web: no socket activation for this process")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return 0, errors.New("web: no socket activation file descriptors")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	ls := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, l := range ls {
+				_ = l.Close()
+			}
+			return 0, fmt.Errorf("web: socket activation fd %d: %w", listenFDsStart+i, err)
+		}
+		ls = append(ls, l)
+	}
+	for _, l := range ls {
+		h.Listen(l, middlewares...)
+	}
+	return n, nil
+}
+
+var errServing = errors.New("web: server already serving")
+
+// Serve 在所有监听上处理请求，直到 Shutdown 之后返回 http.ErrServerClosed
+// 任何一个监听出错的时候关闭其它监听并返回这个错误
+func (h *httpServer) Serve() error {
+	return h.serveListeners(func() {})
+}
+
+func (h *httpServer) isServing() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.servers) > 0
+}
+
+// serveListeners 返回的时候调用 stop 并停止 TLSConfig 启动的证书检查，已经在处理请求的时候只调用 stop
+func (h *httpServer) serveListeners(stop func()) error {
+	h.mu.Lock()
+	listeners := h.listeners
+	if h.closed {
+		h.mu.Unlock()
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		stop()
+		h.stopCertWatchers()
+		return http.ErrServerClosed
+	}
+	if len(h.servers) > 0 {
+		h.mu.Unlock()
+		stop()
+		return errServing
+	}
+	defer h.stopCertWatchers()
+	defer stop()
+	if len(listeners) == 0 {
+		h.mu.Unlock()
+		return errors.New("web: no listener")
+	}
+	servers := make([]*http.Server, 0, len(listeners))
+	for _, l := range listeners {
+		var handler http.Handler = h
+		if len(l.middlewares) > 0 {
+			handler = overlayHandler{server: h, middlewares: l.middlewares}
+		}
+		srv, err := h.newHTTPServer(handler)
+		if err != nil {
+			h.mu.Unlock()
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+		servers = append(servers, srv)
+	}
+	h.servers = servers
+	h.mu.Unlock()
+	h.startServices()
+
+	errCh := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, l net.Listener) {
+			errCh <- srv.Serve(l)
+		}(srv, listeners[i])
+	}
+	var res error
+	for range servers {
+		err := <-errCh
+		if err != http.ErrServerClosed && res == nil {
+			res = err
+			for _, srv := range servers {
+				_ = srv.Close()
+			}
+		}
+	}
+	if res == nil {
+		res = http.ErrServerClosed
+	}
+	return res
+}
+
+// Addrs 所有监听的地址，监听 :0 的时候可以通过它拿到实际的端口
+func (h *httpServer) Addrs() []net.Addr {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]net.Addr, 0, len(h.listeners))
+	for _, l := range h.listeners {
+		res = append(res, l.Addr())
+	}
+	return res
+}
+
+// newHTTPServer 每个监听使用单独的 http.Server
+func (h *httpServer) newHTTPServer(handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       h.readTimeout,
+		ReadHeaderTimeout: h.readHeaderTimeout,
+		WriteTimeout:      h.writeTimeout,
+		IdleTimeout:       h.idleTimeout,
+	}
+	if err := h.configureHTTP2(srv); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// overlayHandler 在server级别的中间件之后加上监听的中间件
+type overlayHandler struct {
+	server      *httpServer
+	middlewares []Middleware
+}
+
+func (o overlayHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	o.server.serveHTTP(writer, request, o.middlewares)
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServer_Listeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket")
+	}
+	overlay := func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			c.Set("listener", "unix")
+			next(c)
+		}
+	}
+	var order []string
+	s := NewHttpServer(WithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			_, ok := c.Get("listener")
+			order = append(order, "server:"+strconv.FormatBool(ok))
+			next(c)
+		}
+	}))
+	s.Get("/listener", func(c *Context) {
+		val, _ := Value[string](c, "listener")
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte(val)
+	})
+
+	require.NoError(t, s.ListenTCP("127.0.0.1:0"))
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	// 残留的套接字文件会被删除
+	stale, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+	require.NoError(t, s.ListenUnix(sock, 0660, overlay))
+	injected, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s.Listen(injected)
+	assert.Len(t, s.Addrs(), 3)
+
+	info, err := os.Stat(sock)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve()
+	}()
+
+	get := func(cli *http.Client, url string) string {
+		var body string
+		require.Eventually(t, func() bool {
+			resp, err := cli.Get(url)
+			if err != nil {
+				return false
+			}
+			body = readBody(t, resp)
+			return true
+		}, time.Second, 10*time.Millisecond)
+		return body
+	}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	assert.Equal(t, "", get(http.DefaultClient, "http://"+s.Addrs()[0].String()+"/listener"))
+	assert.Equal(t, "unix", get(unixClient, "http://unix/listener"))
+	assert.Equal(t, "", get(http.DefaultClient, "http://"+injected.Addr().String()+"/listener"))
+	// 监听的中间件在server的中间件之后执行
+	assert.Equal(t, []string{"server:false", "server:false", "server:false"}, order)
+
+	assert.Error(t, s.Serve())
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+
+	// 已经关闭之后不能再启动
+	require.NoError(t, s.ListenTCP("127.0.0.1:0"))
+	assert.Equal(t, http.ErrServerClosed, s.Serve())
+}
+
+func TestServer_ListenSystemd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket activation")
+	}
+	s := NewHttpServer()
+	_, err := s.ListenSystemd()
+	assert.Error(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "http")
+	defer func(start int) {
+		listenFDsStart = start
+	}(listenFDsStart)
+	listenFDsStart = int(f.Fd())
+
+	n, err := s.ListenSystemd()
+	// ListenSystemd 已经关闭了继承的文件描述符
+	_ = f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, l.Addr().String(), s.Addrs()[0].String())
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	s.Get("/", func(c *Context) {
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte("activated")
+	})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve()
+	}()
+	resp, err := http.Get("http://" + s.Addrs()[0].String() + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "activated", readBody(t, resp))
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+}
+
+func TestServer_Timeouts(t *testing.T) {
+	s := NewHttpServer(WithReadTimeout(time.Second), WithReadHeaderTimeout(2*time.Second),
+		WithWriteTimeout(3*time.Second), WithIdleTimeout(4*time.Second))
+	srv, err := s.newHTTPServer(s)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.IdleTimeout)
+}
@@ -1,14 +1,91 @@
 package web
 
-import "sync"
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+)
 
 type Middleware func(next HandleFunc) HandleFunc
 
+// WrapHandler 把 http.Handler 转换成 HandleFunc，handler 直接写 c.Writer
+func WrapHandler(handler http.Handler) HandleFunc {
+	return func(c *Context) {
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// funcNames 中间件的函数名，用于展示配置
+func funcNames(middlewares []Middleware) []string {
+	res := make([]string, 0, len(middlewares))
+	for _, m := range middlewares {
+		res = append(res, runtime.FuncForPC(reflect.ValueOf(m).Pointer()).Name())
+	}
+	return res
+}
+
+// buildChain 把中间件和业务逻辑串起来
+// 每一环执行之前都会检查 context 是否被中断，被中断之后就不再往下执行
+func buildChain(handleFunc HandleFunc, middlewares []Middleware) HandleFunc {
+	cur := abortable(handleFunc)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		cur = abortable(middlewares[i](cur))
+	}
+	return cur
+}
+
+func abortable(next HandleFunc) HandleFunc {
+	return func(c *Context) {
+		if c.IsAborted() {
+			return
+		}
+		next(c)
+	}
+}
+
 // Intercept =====================================
+// 拦截器，比中间件更容易理解的扩展方式，通过 InterceptMiddleware 转换成中间件
+// 执行顺序：Before -> Surround -> After
+// - Before 中断了 context 之后 Surround 不会执行
+// - Surround 需要自己调用 next 执行后面的中间件和业务逻辑
+// - After 即使后面panic了也会执行
 type Intercept interface {
 	Before(c *Context)
 	After(c *Context)
-	Surround(c *Context)
+	Surround(c *Context, next HandleFunc)
+}
+
+// BaseIntercept 什么都不做的拦截器，嵌入之后只需要实现关心的方法
+type BaseIntercept struct{}
+
+func (BaseIntercept) Before(c *Context) {}
+
+func (BaseIntercept) After(c *Context) {}
+
+func (BaseIntercept) Surround(c *Context, next HandleFunc) {
+	next(c)
+}
+
+// InterceptMiddleware 把拦截器转换成中间件
+func InterceptMiddleware(i Intercept) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			defer i.After(c)
+			i.Before(c)
+			if c.IsAborted() {
+				return
+			}
+			i.Surround(c, next)
+		}
+	}
+}
+
+func interceptMiddlewares(intercepts []Intercept) []Middleware {
+	res := make([]Middleware, 0, len(intercepts))
+	for _, i := range intercepts {
+		res = append(res, InterceptMiddleware(i))
+	}
+	return res
 }
 
 // Chain =========================================
@@ -27,34 +104,3 @@ func (c ChainV1) Run(ctx *Context) {
 		}
 	}
 }
-
-// Net =========================================
-type Net struct {
-	handlers []HandleFuncV2
-}
-
-func (n Net) Run(ctx *Context) {
-	wg := sync.WaitGroup{}
-	for _, handler := range n.handlers {
-		h := handler
-		if h.concurrent {
-			wg.Add(1)
-			go func() {
-				h.Run(ctx)
-				wg.Done()
-			}()
-		} else {
-			h.Run(ctx)
-		}
-	}
-	wg.Wait()
-}
-
-type HandleFuncV2 struct {
-	concurrent bool
-	handlers   []*HandleFuncV2
-}
-
-func (h HandleFuncV2) Run(ctx *Context) {
-
-}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type logIntercept struct {
+	BaseIntercept
+	name   string
+	actual *[]string
+}
+
+func (l logIntercept) Before(c *Context) {
+	*l.actual = append(*l.actual, l.name+" before")
+}
+
+func (l logIntercept) After(c *Context) {
+	*l.actual = append(*l.actual, l.name+" after")
+}
+
+type surroundIntercept struct {
+	BaseIntercept
+	actual *[]string
+}
+
+func (s surroundIntercept) Surround(c *Context, next HandleFunc) {
+	*s.actual = append(*s.actual, "surround start")
+	next(c)
+	*s.actual = append(*s.actual, "surround end")
+}
+
+type authIntercept struct {
+	BaseIntercept
+}
+
+func (authIntercept) Before(c *Context) {
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+func TestInterceptMiddleware(t *testing.T) {
+	actual := []string{}
+	md := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(c *Context) {
+				actual = append(actual, name)
+				next(c)
+			}
+		}
+	}
+
+	s := NewHttpServer(
+		WithMiddleware(md("md1")),
+		WithIntercepts(logIntercept{name: "i1", actual: &actual}),
+		WithMiddleware(md("md2")),
+	)
+	s.Get("/user", func(c *Context) {
+		actual = append(actual, "handler")
+	})
+	s.Get("/panic", func(c *Context) {
+		panic("panic")
+	})
+	s.Get("/auth", func(c *Context) {
+		actual = append(actual, "handler")
+	})
+	s.UseInterceptWithRoute(http.MethodGet, "/user", surroundIntercept{actual: &actual})
+	s.UseInterceptWithRoute(http.MethodGet, "/auth", authIntercept{}, logIntercept{name: "i2", actual: &actual})
+
+	testcase := []struct {
+		name       string
+		path       string
+		want       []string
+		wantPanic  bool
+		wantStatus int
+	}{
+		{
+			name:       "order",
+			path:       "/user",
+			want:       []string{"md1", "i1 before", "md2", "surround start", "handler", "surround end", "i1 after"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:      "after on panic",
+			path:      "/panic",
+			want:      []string{"md1", "i1 before", "md2", "i1 after"},
+			wantPanic: true,
+		},
+		{
+			name:       "abort in before",
+			path:       "/auth",
+			want:       []string{"md1", "i1 before", "md2", "i1 after"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range testcase {
+		t.Run(tt.name, func(t *testing.T) {
+			actual = []string{}
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.wantPanic {
+				assert.Panics(t, func() { s.ServeHTTP(recorder, request) })
+			} else {
+				s.ServeHTTP(recorder, request)
+				assert.Equal(t, tt.wantStatus, recorder.Code)
+			}
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}
@@ -27,6 +27,7 @@ func (m MiddlewareBuilder) Build() web.Middleware {
 					Router:     c.MatchedRoute,
 					HttpMethod: c.Request.Method,
 					Path:       c.Request.URL.Path,
+					Protocol:   c.Protocol(),
 				}
 				bytes, _ := json.Marshal(l)
 				m.logFunc(string(bytes))
@@ -41,4 +42,5 @@ type acesslog struct {
 	Router     string `json:"router,omitempty"`
 	HttpMethod string `json:"http_method,omitempty"`
 	Path       string `json:"path,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
 }
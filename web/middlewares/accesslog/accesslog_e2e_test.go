@@ -2,18 +2,24 @@ package accesslog
 
 import (
 	"WebFramework/web"
-	"fmt"
+	"WebFramework/web/webtest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
 )
 
 func TestBuilderE2E(t *testing.T) {
+	var logs []string
 	middleware := NewBuilder().LogFunc(func(log string) {
-		fmt.Println(log)
+		logs = append(logs, log)
 	}).Build()
 	s := web.NewHttpServer(web.WithMiddleware(middleware))
 	s.Get("/a/b/*", func(c *web.Context) {
-		fmt.Println("业务逻辑")
+		c.RespStatusCode = http.StatusOK
 	})
 
-	_ = s.Start(":8080")
+	webtest.New(t, s).Get("/a/b/c").Expect().Status(http.StatusOK)
+	if assert.Len(t, logs, 1) {
+		assert.Contains(t, logs[0], `"router":"/a/b/*"`)
+	}
 }
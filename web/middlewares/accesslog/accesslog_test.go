@@ -2,21 +2,27 @@ package accesslog
 
 import (
 	"WebFramework/web"
-	"fmt"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestBuilder(t *testing.T) {
+	var logs []string
 	middleware := NewBuilder().LogFunc(func(log string) {
-		fmt.Println(log)
+		logs = append(logs, log)
 	}).Build()
 	s := web.NewHttpServer(web.WithMiddleware(middleware))
 	s.Post("/a/b/*", func(c *web.Context) {
-		fmt.Println("业务逻辑")
+		c.RespStatusCode = http.StatusOK
 	})
 
-	request, _ := http.NewRequest(http.MethodPost, "/a/b/c", nil)
+	request := httptest.NewRequest(http.MethodPost, "/a/b/c", nil)
 	request.Host = "localhost"
-	s.ServeHTTP(nil, request)
+	s.ServeHTTP(httptest.NewRecorder(), request)
+	if assert.Len(t, logs, 1) {
+		assert.Contains(t, logs[0], `"host":"localhost"`)
+		assert.Contains(t, logs[0], `"http_method":"POST"`)
+	}
 }
@@ -0,0 +1,387 @@
+package cache
+
+import (
+	"WebFramework/web"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storeKey = "cache.store"
+	tagsKey  = "cache.tags"
+)
+
+// Tag 给当前请求的响应打上 tag，之后可以通过 Invalidate 删除
+func Tag(c *web.Context, tags ...string) {
+	exist, _ := web.Value[[]string](c, tagsKey)
+	c.Set(tagsKey, append(exist[:len(exist):len(exist)], tags...))
+}
+
+// Invalidate 删除带有任何一个 tag 的缓存，需要在缓存中间件里面调用，例如修改资源的业务逻辑
+func Invalidate(c *web.Context, tags ...string) error {
+	store, ok := web.Value[Store](c, storeKey)
+	if !ok {
+		return errors.New("cache: no store in context, is the cache middleware registered?")
+	}
+	return store.InvalidateTags(c.Request.Context(), tags...)
+}
+
+type MiddlewareBuilder struct {
+	ttl      time.Duration
+	routeTTL map[string]time.Duration
+	staleTTL time.Duration
+	// 后台刷新的超时时间，为0的时候使用路由的缓存时间
+	revalidateTimeout time.Duration
+	store             Store
+	prefix            string
+	headers           []string
+	now               func() time.Time
+	log               func(msg string, args ...any)
+}
+
+// NewBuilder 缓存GET和HEAD请求，ttl 为0表示只缓存通过 RouteTTL 设置了的路由
+// 默认使用最多保存10000个响应的 MemoryStore
+func NewBuilder(ttl time.Duration) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		ttl:      ttl,
+		routeTTL: map[string]time.Duration{},
+		store:    NewMemoryStore(10000),
+		now:      time.Now,
+		log: func(msg string, args ...any) {
+			fmt.Printf(msg, args...)
+		},
+	}
+}
+
+// RouteTTL 单独设置某个路由的缓存时间，route 是注册路由时候的路径，例如 /user/:id，ttl 为0表示不缓存
+func (m *MiddlewareBuilder) RouteTTL(route string, ttl time.Duration) *MiddlewareBuilder {
+	m.routeTTL[route] = ttl
+	return m
+}
+
+// StaleWhileRevalidate 过期之后 d 以内的请求直接使用旧的响应，同时在后台刷新
+// 响应的 Cache-Control 里面的 stale-while-revalidate 优先
+func (m *MiddlewareBuilder) StaleWhileRevalidate(d time.Duration) *MiddlewareBuilder {
+	m.staleTTL = d
+	return m
+}
+
+// RevalidateTimeout 后台刷新的超时时间，默认是路由的缓存时间
+func (m *MiddlewareBuilder) RevalidateTimeout(timeout time.Duration) *MiddlewareBuilder {
+	m.revalidateTimeout = timeout
+	return m
+}
+
+// Headers 组成缓存key的请求头，例如 Accept-Language
+// 响应的 Vary 里面有其它请求头的时候不缓存
+func (m *MiddlewareBuilder) Headers(names ...string) *MiddlewareBuilder {
+	m.headers = make([]string, 0, len(names))
+	for _, name := range names {
+		m.headers = append(m.headers, http.CanonicalHeaderKey(name))
+	}
+	return m
+}
+
+// Store 多个中间件共享同一个 Store 的时候需要通过 Prefix 区分
+func (m *MiddlewareBuilder) Store(store Store) *MiddlewareBuilder {
+	m.store = store
+	return m
+}
+
+// Prefix key的前缀
+func (m *MiddlewareBuilder) Prefix(prefix string) *MiddlewareBuilder {
+	m.prefix = prefix
+	return m
+}
+
+func (m *MiddlewareBuilder) LogFunc(log func(msg string, args ...any)) *MiddlewareBuilder {
+	m.log = log
+	return m
+}
+
+// Build 响应头 X-Cache 表示是否命中：HIT、STALE、COALESCED 或者 MISS
+// 同一个key上并发的未命中只有一个请求执行业务逻辑，其它请求等待它的结果，使用这个结果的时候是 COALESCED
+// 结果不能缓存的时候不会共享给其它请求，因为它可能只属于这个请求，等待的请求各自执行业务逻辑
+// 所以合并只对可以缓存的响应有效，一直不能缓存的热点路由应该通过 RouteTTL 关掉缓存
+// 压缩之类会修改响应的中间件应该注册在缓存中间件外面，Store 出错的时候当作未命中
+func (m MiddlewareBuilder) Build() web.Middleware {
+	g := &group{calls: map[string]*call{}}
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			c.Set(storeKey, m.store)
+			if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				next(c)
+				return
+			}
+			ttl, ok := m.routeTTL[c.MatchedRoute]
+			if !ok {
+				ttl = m.ttl
+			}
+			reqCC := parseCacheControl(c.Request.Header.Get("Cache-Control"))
+			if c.MatchedRoute == "" || ttl <= 0 || reqCC.noStore {
+				next(c)
+				return
+			}
+
+			key := m.key(c)
+			// 带有 Authorization 的请求的响应可能只属于这个用户，key 里面没有凭证，RFC 9111 3.5
+			// 所以不查缓存也不合并，响应明确是 public 或者带有 s-maxage 的时候才保存
+			if c.Request.Header.Get("Authorization") != "" {
+				m.fill(c, next, key, ttl, true)
+				return
+			}
+			now := m.now()
+			if !reqCC.noCache {
+				entry, ok, err := m.store.Get(c.Request.Context(), key)
+				if err != nil {
+					m.log("cache: store error: %v\n", err)
+				}
+				if ok && (reqCC.maxAge < 0 || age(entry, now) <= reqCC.maxAge) {
+					if now.Before(entry.FreshUntil) {
+						m.serve(c, entry, now, "HIT")
+						return
+					}
+					if now.Before(entry.StaleUntil) {
+						m.serve(c, entry, now, "STALE")
+						m.revalidate(g, c, next, key, ttl)
+						return
+					}
+				}
+			}
+
+			cl, leader := g.join(key)
+			if !leader {
+				select {
+				case <-cl.done:
+				case <-c.Request.Context().Done():
+					return
+				}
+				if cl.entry != nil {
+					m.serve(c, cl.entry, m.now(), "COALESCED")
+					return
+				}
+				m.fill(c, next, key, ttl, false)
+				return
+			}
+			defer g.finish(key, cl)
+			cl.entry = m.fill(c, next, key, ttl, false)
+		}
+	}
+}
+
+// fill 执行业务逻辑，响应可以缓存的时候保存下来
+func (m MiddlewareBuilder) fill(c *web.Context, next web.HandleFunc, key string, ttl time.Duration, authorized bool) *Entry {
+	before := c.Writer.Header().Clone()
+	original := c.Writer
+	w := &trackWriter{ResponseWriter: original}
+	c.Writer = w
+	next(c)
+	c.Writer = original
+	var entry *Entry
+	if !w.written {
+		entry = m.save(c, before, key, ttl, authorized)
+	}
+	c.Writer.Header().Set("X-Cache", "MISS")
+	return entry
+}
+
+// key 由method、路由、路径、查询参数和配置的请求头组成，查询参数按照名字排序
+func (m MiddlewareBuilder) key(c *web.Context) string {
+	sb := strings.Builder{}
+	sb.WriteString(m.prefix)
+	sb.WriteString(c.Request.Method)
+	sb.WriteString(" ")
+	sb.WriteString(c.MatchedRoute)
+	sb.WriteString(" ")
+	sb.WriteString(c.Request.URL.Path)
+	sb.WriteString("?")
+	sb.WriteString(c.Request.URL.Query().Encode())
+	for _, name := range m.headers {
+		sb.WriteString("|")
+		sb.WriteString(name)
+		sb.WriteString("=")
+		sb.WriteString(strings.Join(c.Request.Header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+// serve 使用缓存的响应，不再执行业务逻辑
+func (m MiddlewareBuilder) serve(c *web.Context, entry *Entry, now time.Time, status string) {
+	header := c.Writer.Header()
+	for k, v := range entry.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set("Age", strconv.Itoa(age(entry, now)))
+	header.Set("X-Cache", status)
+	c.RespStatusCode = entry.StatusCode
+	c.RespData = entry.Data
+}
+
+// save 响应可以缓存的时候保存，返回保存的 Entry，before 是执行业务逻辑之前的响应头，不会被缓存
+// authorized 表示请求带有 Authorization，这个时候响应必须是 public 或者带有 s-maxage
+func (m MiddlewareBuilder) save(c *web.Context, before http.Header, key string, ttl time.Duration, authorized bool) *Entry {
+	status := c.RespStatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := c.Writer.Header()
+	if c.Err() != nil || !cacheableStatus[status] || header.Get("Set-Cookie") != "" || !m.varyCovered(header) {
+		return nil
+	}
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if cc.noStore || cc.noCache || cc.private || authorized && !cc.public && cc.sMaxAge < 0 {
+		return nil
+	}
+	if cc.sMaxAge >= 0 {
+		ttl = time.Duration(cc.sMaxAge) * time.Second
+	} else if cc.maxAge >= 0 {
+		ttl = time.Duration(cc.maxAge) * time.Second
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	staleTTL := m.staleTTL
+	if cc.staleWhileRevalidate >= 0 {
+		staleTTL = time.Duration(cc.staleWhileRevalidate) * time.Second
+	}
+
+	stored := http.Header{}
+	for k, v := range header {
+		if !equal(before[k], v) {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+	tags, _ := web.Value[[]string](c, tagsKey)
+	now := m.now()
+	entry := &Entry{
+		StatusCode: status,
+		Header:     stored,
+		Data:       append([]byte(nil), c.RespData...),
+		Tags:       tags,
+		StoredAt:   now,
+		FreshUntil: now.Add(ttl),
+		StaleUntil: now.Add(ttl + staleTTL),
+	}
+	if err := m.store.Set(c.Request.Context(), key, entry); err != nil {
+		m.log("cache: store error: %v\n", err)
+	}
+	return entry
+}
+
+// varyCovered 响应的 Vary 里面的请求头都在缓存key里面
+func (m MiddlewareBuilder) varyCovered(header http.Header) bool {
+	for _, val := range header.Values("Vary") {
+		for _, name := range strings.Split(val, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			covered := false
+			for _, h := range m.headers {
+				if h == name {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// revalidate 在后台重新执行业务逻辑刷新缓存，同一个key同时只会有一个刷新
+// 在复制出来的 Context 上执行，存储的数据和路径参数都是副本
+func (m MiddlewareBuilder) revalidate(g *group, c *web.Context, next web.HandleFunc, key string, ttl time.Duration) {
+	cl, leader := g.join(key)
+	if !leader {
+		return
+	}
+	timeout := m.revalidateTimeout
+	if timeout <= 0 {
+		timeout = ttl
+	}
+	// 原来的请求已经结束了，不能使用它的 context，也不能和它共享路径参数
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	w := &discardWriter{header: http.Header{}}
+	clone := c.Clone(w, c.Request.Clone(ctx))
+	clone.Params = make(map[string]string, len(c.Params))
+	for k, v := range c.Params {
+		clone.Params[k] = v
+	}
+	clone.RespData = nil
+	clone.RespStatusCode = 0
+	clone.Set(tagsKey, []string(nil))
+	go func() {
+		defer g.finish(key, cl)
+		defer cancel()
+		defer func() {
+			if p := recover(); p != nil {
+				m.log("cache: revalidate panic: %v\n", p)
+			}
+		}()
+		next(clone)
+		if !w.written {
+			cl.entry = m.save(clone, http.Header{}, key, ttl, false)
+		}
+	}()
+}
+
+// age 缓存了多少秒
+func age(entry *Entry, now time.Time) int {
+	res := int(now.Sub(entry.StoredAt) / time.Second)
+	if res < 0 {
+		return 0
+	}
+	return res
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// group 合并同一个key上并发的未命中
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	// 结果不能缓存的时候为nil
+	entry *Entry
+}
+
+// join 返回true表示调用方需要执行业务逻辑，结束之后调用 finish
+func (g *group) join(key string) (*call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cl, ok := g.calls[key]; ok {
+		return cl, false
+	}
+	cl := &call{done: make(chan struct{})}
+	g.calls[key] = cl
+	return cl, true
+}
+
+func (g *group) finish(key string, cl *call) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(cl.done)
+}
@@ -0,0 +1,470 @@
+package cache
+
+import (
+	"WebFramework/web"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder func() *MiddlewareBuilder
+		// 两次请求的路径和请求头
+		paths   [2]string
+		headers [2]map[string]string
+		// 业务逻辑设置的响应
+		respHeaders map[string]string
+		status      int
+		err         bool
+
+		wantCache string
+		wantCalls int32
+	}{
+		{
+			name:      "hit",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			wantCache: "HIT",
+			wantCalls: 1,
+		},
+		{
+			name:      "query order",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1?a=1&b=2", "/user/1?b=2&a=1"},
+			wantCache: "HIT",
+			wantCalls: 1,
+		},
+		{
+			name:      "different query",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1?a=1", "/user/1?a=2"},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "different path",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/2"},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "different header",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute).Headers("accept-language") },
+			paths:     [2]string{"/user/1", "/user/1"},
+			headers:   [2]map[string]string{{"Accept-Language": "en"}, {"Accept-Language": "zh"}},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "authorization not shared",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			headers:   [2]map[string]string{{"Authorization": "Bearer tom"}, {"Authorization": "Bearer jerry"}},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "authorization to anonymous",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			headers:   [2]map[string]string{{"Authorization": "Bearer tom"}},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:        "authorization public",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			headers:     [2]map[string]string{{"Authorization": "Bearer tom"}},
+			respHeaders: map[string]string{"Cache-Control": "public, max-age=60"},
+			wantCache:   "HIT",
+			wantCalls:   1,
+		},
+		{
+			name:        "authorization s-maxage",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			headers:     [2]map[string]string{{"Authorization": "Bearer tom"}},
+			respHeaders: map[string]string{"Cache-Control": "s-maxage=60"},
+			wantCache:   "HIT",
+			wantCalls:   1,
+		},
+		{
+			name:      "route ttl disabled",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute).RouteTTL("/user/:id", 0) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			wantCalls: 2,
+		},
+		{
+			name:      "route ttl only",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(0).RouteTTL("/user/:id", time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			wantCache: "HIT",
+			wantCalls: 1,
+		},
+		{
+			name:      "request no store",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			headers:   [2]map[string]string{{"Cache-Control": "no-store"}, nil},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "request no cache",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			headers:   [2]map[string]string{nil, {"Cache-Control": "no-cache"}},
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "request max age",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			headers:   [2]map[string]string{nil, {"Cache-Control": "max-age=0"}},
+			wantCache: "HIT",
+			wantCalls: 1,
+		},
+		{
+			name:        "response no store",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			respHeaders: map[string]string{"Cache-Control": "no-store"},
+			wantCache:   "MISS",
+			wantCalls:   2,
+		},
+		{
+			name:        "response private",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			respHeaders: map[string]string{"Cache-Control": "private, max-age=60"},
+			wantCache:   "MISS",
+			wantCalls:   2,
+		},
+		{
+			name:        "response max age",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(0).RouteTTL("/user/:id", time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			respHeaders: map[string]string{"Cache-Control": "max-age=0"},
+			wantCache:   "MISS",
+			wantCalls:   2,
+		},
+		{
+			name:        "set cookie",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			respHeaders: map[string]string{"Set-Cookie": "session=1"},
+			wantCache:   "MISS",
+			wantCalls:   2,
+		},
+		{
+			name:        "vary not covered",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:       [2]string{"/user/1", "/user/1"},
+			respHeaders: map[string]string{"Vary": "Accept-Language"},
+			wantCache:   "MISS",
+			wantCalls:   2,
+		},
+		{
+			name:        "vary covered",
+			builder:     func() *MiddlewareBuilder { return NewBuilder(time.Minute).Headers("Accept-Language") },
+			paths:       [2]string{"/user/1", "/user/1"},
+			respHeaders: map[string]string{"Vary": "accept-language"},
+			wantCache:   "HIT",
+			wantCalls:   1,
+		},
+		{
+			name:      "server error",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			status:    http.StatusInternalServerError,
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "handler error",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			err:       true,
+			wantCache: "MISS",
+			wantCalls: 2,
+		},
+		{
+			name:      "not found cached",
+			builder:   func() *MiddlewareBuilder { return NewBuilder(time.Minute) },
+			paths:     [2]string{"/user/1", "/user/1"},
+			status:    http.StatusNotFound,
+			wantCache: "HIT",
+			wantCalls: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			s := web.NewHttpServer(web.WithMiddleware(tc.builder().Build()))
+			s.Get("/user/:id", func(c *web.Context) {
+				n := atomic.AddInt32(&calls, 1)
+				for k, v := range tc.respHeaders {
+					c.Writer.Header().Set(k, v)
+				}
+				if tc.err {
+					c.Error(web.NewHTTPError(http.StatusBadGateway, ""))
+					return
+				}
+				c.RespStatusCode = tc.status
+				if c.RespStatusCode == 0 {
+					c.RespStatusCode = http.StatusOK
+				}
+				c.RespData = []byte(strconv.Itoa(int(n)))
+			})
+
+			var recorder *httptest.ResponseRecorder
+			for i, path := range tc.paths {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				for k, v := range tc.headers[i] {
+					req.Header.Set(k, v)
+				}
+				recorder = httptest.NewRecorder()
+				s.ServeHTTP(recorder, req)
+			}
+			assert.Equal(t, tc.wantCache, recorder.Header().Get("X-Cache"))
+			assert.Equal(t, tc.wantCalls, atomic.LoadInt32(&calls))
+			if tc.wantCache == "HIT" {
+				assert.Equal(t, "1", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Headers(t *testing.T) {
+	// 外层中间件设置的响应头不会被缓存
+	var calls int32
+	outer := func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			c.Writer.Header().Set("X-Request-Id", strconv.Itoa(int(atomic.AddInt32(&calls, 1))))
+			next(c)
+		}
+	}
+	s := web.NewHttpServer(web.WithMiddleware(outer, NewBuilder(time.Minute).Build()))
+	s.Get("/user/:id", func(c *web.Context) {
+		c.Writer.Header().Set("Content-Type", "text/plain")
+		c.RespStatusCode = http.StatusCreated
+		c.RespData = []byte("user")
+	})
+
+	for i := 1; i <= 2; i++ {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, "user", recorder.Body.String())
+		assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, strconv.Itoa(i), recorder.Header().Get("X-Request-Id"))
+	}
+}
+
+func TestMiddlewareBuilder_StaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	store := NewMemoryStore(10)
+	store.now = clock
+	builder := NewBuilder(time.Minute).StaleWhileRevalidate(time.Minute).RevalidateTimeout(5 * time.Second).Store(store)
+	builder.now = clock
+
+	var calls int32
+	revalidated := make(chan time.Duration, 1)
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
+	s.Get("/user/:id", func(c *web.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		c.RespData = []byte(strconv.Itoa(int(n)))
+		if n == 2 {
+			// 后台刷新有超时时间
+			deadline, _ := c.Request.Context().Deadline()
+			revalidated <- time.Until(deadline)
+		}
+	})
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+		return recorder
+	}
+
+	assert.Equal(t, "MISS", get().Header().Get("X-Cache"))
+
+	advance(30 * time.Second)
+	recorder := get()
+	assert.Equal(t, "HIT", recorder.Header().Get("X-Cache"))
+	assert.Equal(t, "30", recorder.Header().Get("Age"))
+
+	advance(time.Minute)
+	recorder = get()
+	assert.Equal(t, "STALE", recorder.Header().Get("X-Cache"))
+	assert.Equal(t, "1", recorder.Body.String())
+	select {
+	case remain := <-revalidated:
+		assert.True(t, remain > 0 && remain <= 5*time.Second)
+	case <-time.After(time.Second):
+		t.Fatal("not revalidated")
+	}
+	require.Eventually(t, func() bool {
+		return get().Body.String() == "2"
+	}, time.Second, 10*time.Millisecond)
+
+	// 超过 stale-while-revalidate 之后重新执行业务逻辑
+	advance(3 * time.Minute)
+	recorder = get()
+	assert.Equal(t, "MISS", recorder.Header().Get("X-Cache"))
+	assert.Equal(t, "3", recorder.Body.String())
+}
+
+func TestMiddlewareBuilder_Coalescing(t *testing.T) {
+	testCases := []struct {
+		name         string
+		cacheControl string
+
+		wantCalls int32
+		// 每种 X-Cache 的个数
+		wantCache map[string]int
+	}{
+		{
+			name:      "cacheable",
+			wantCalls: 1,
+			wantCache: map[string]int{"MISS": 1, "COALESCED": 9},
+		},
+		{
+			// 不能缓存的响应不共享，等待的请求各自执行业务逻辑
+			name:         "not cacheable",
+			cacheControl: "no-store",
+			wantCalls:    10,
+			wantCache:    map[string]int{"MISS": 10},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			release := make(chan struct{})
+			s := web.NewHttpServer(web.WithMiddleware(NewBuilder(time.Minute).Build()))
+			s.Get("/user/:id", func(c *web.Context) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				if tc.cacheControl != "" {
+					c.Writer.Header().Set("Cache-Control", tc.cacheControl)
+				}
+				c.RespData = []byte("user")
+			})
+
+			const n = 10
+			var wg sync.WaitGroup
+			bodies, caches := make([]string, n), make([]string, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					recorder := httptest.NewRecorder()
+					s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+					bodies[i] = recorder.Body.String()
+					caches[i] = recorder.Header().Get("X-Cache")
+				}(i)
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			assert.Equal(t, tc.wantCalls, atomic.LoadInt32(&calls))
+			got := map[string]int{}
+			for i, body := range bodies {
+				assert.Equal(t, "user", body)
+				got[caches[i]]++
+			}
+			assert.Equal(t, tc.wantCache, got)
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	var calls int32
+	s := web.NewHttpServer(web.WithMiddleware(NewBuilder(time.Minute).Build()))
+	s.Get("/user/:id", func(c *web.Context) {
+		Tag(c, "user:"+c.Params["id"])
+		c.RespData = []byte(strconv.Itoa(int(atomic.AddInt32(&calls, 1))))
+	})
+	s.Post("/user/:id", func(c *web.Context) {
+		if err := Invalidate(c, "user:"+c.Params["id"]); err != nil {
+			c.Error(err)
+		}
+	})
+	get := func(path string) string {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Header().Get("X-Cache")
+	}
+
+	assert.Equal(t, "MISS", get("/user/1"))
+	assert.Equal(t, "MISS", get("/user/2"))
+	assert.Equal(t, "HIT", get("/user/1"))
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/user/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "MISS", get("/user/1"))
+	assert.Equal(t, "HIT", get("/user/2"))
+
+	c := &web.Context{Request: httptest.NewRequest(http.MethodPost, "/", nil)}
+	assert.Error(t, Invalidate(c, "user:1"))
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(2)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	entry := func(tags ...string) *Entry {
+		return &Entry{Tags: tags, StaleUntil: now.Add(time.Minute)}
+	}
+
+	require.NoError(t, store.Set(ctx, "a", entry("t1")))
+	require.NoError(t, store.Set(ctx, "b", entry("t1", "t2")))
+	_, ok, _ := store.Get(ctx, "a")
+	assert.True(t, ok)
+	// 超过容量的时候清除最久没有访问的b
+	require.NoError(t, store.Set(ctx, "c", entry("t2")))
+	_, ok, _ = store.Get(ctx, "b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, store.Len())
+
+	require.NoError(t, store.InvalidateTags(ctx, "t2"))
+	_, ok, _ = store.Get(ctx, "c")
+	assert.False(t, ok)
+	assert.Equal(t, 1, store.Len())
+	assert.Len(t, store.tags, 1)
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	assert.Equal(t, 0, store.Len())
+	assert.Len(t, store.tags, 0)
+
+	require.NoError(t, store.Set(ctx, "d", entry()))
+	now = now.Add(time.Minute)
+	_, ok, _ = store.Get(ctx, "d")
+	assert.False(t, ok)
+}
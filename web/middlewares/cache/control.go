@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cacheControl Cache-Control 里面用到的指令，没有设置的秒数为-1
+type cacheControl struct {
+	noStore              bool
+	noCache              bool
+	private              bool
+	public               bool
+	maxAge               int
+	sMaxAge              int
+	staleWhileRevalidate int
+}
+
+func parseCacheControl(val string) cacheControl {
+	res := cacheControl{maxAge: -1, sMaxAge: -1, staleWhileRevalidate: -1}
+	for _, directive := range strings.Split(val, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			res.noStore = true
+		case "no-cache":
+			res.noCache = true
+		case "private":
+			res.private = true
+		case "public":
+			res.public = true
+		case "max-age":
+			res.maxAge = parseSeconds(arg)
+		case "s-maxage":
+			res.sMaxAge = parseSeconds(arg)
+		case "stale-while-revalidate":
+			res.staleWhileRevalidate = parseSeconds(arg)
+		}
+	}
+	return res
+}
+
+func parseSeconds(val string) int {
+	n, err := strconv.Atoi(strings.Trim(val, `"`))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// cacheableStatus 默认可以缓存的响应码，RFC 9110 15.1
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// trackWriter 记录业务逻辑是否直接写了响应，直接写的响应没法缓存
+type trackWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *trackWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackWriter) Flush() {
+	w.written = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// discardWriter 后台刷新缓存的时候使用
+type discardWriter struct {
+	header  http.Header
+	written bool
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return len(data), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {
+	w.written = true
+}
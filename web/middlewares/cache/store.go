@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry 缓存的响应
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Data       []byte
+	Tags       []string
+	StoredAt   time.Time
+	// FreshUntil 之前直接使用，之后到 StaleUntil 之前先使用再在后台刷新
+	FreshUntil time.Time
+	StaleUntil time.Time
+}
+
+// Store 保存缓存的响应，多个实例共享缓存的时候可以基于redis之类的实现
+// 返回的 Entry 不能被修改
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, bool, error)
+	// Set 保存到 entry.StaleUntil
+	Set(ctx context.Context, key string, entry *Entry) error
+	Delete(ctx context.Context, keys ...string) error
+	// InvalidateTags 删除带有任何一个 tag 的缓存
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+// MemoryStore 单机的 Store，过期或者超过容量之后清除最久没有访问的缓存
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	items      map[string]*list.Element
+	// 按照访问时间排序，最近访问的在前面
+	lru *list.List
+	// tag 到 key 的索引
+	tags map[string]map[string]struct{}
+	now  func() time.Time
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemoryStore maxEntries 为0表示不限制缓存的数量
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		items:      map[string]*list.Element{},
+		lru:        list.New(),
+		tags:       map[string]map[string]struct{}{},
+		now:        time.Now,
+	}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (*Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := elem.Value.(*memoryItem)
+	if !item.entry.StaleUntil.After(m.now()) {
+		m.remove(elem)
+		return nil, false, nil
+	}
+	m.lru.MoveToFront(elem)
+	return item.entry, true, nil
+}
+
+func (m *MemoryStore) Set(ctx context.Context, key string, entry *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.items[key]; ok {
+		m.remove(elem)
+	}
+	m.items[key] = m.lru.PushFront(&memoryItem{key: key, entry: entry})
+	for _, tag := range entry.Tags {
+		keys, ok := m.tags[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			m.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	if m.maxEntries > 0 && m.lru.Len() > m.maxEntries {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := m.items[key]; ok {
+			m.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			m.remove(m.items[key])
+		}
+	}
+	return nil
+}
+
+// Len 缓存的数量
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *MemoryStore) remove(elem *list.Element) {
+	item := elem.Value.(*memoryItem)
+	m.lru.Remove(elem)
+	delete(m.items, item.key)
+	for _, tag := range item.entry.Tags {
+		delete(m.tags[tag], item.key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State 熔断器的状态
+type State int
+
+const (
+	// Closed 正常放行，统计失败率
+	Closed State = iota
+	// Open 直接返回降级响应
+	Open
+	// HalfOpen 放行少量探测请求，成功之后关闭，失败之后重新打开
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// 状态变化，在锁外面通知
+type transition struct {
+	from, to State
+}
+
+// config 熔断的参数
+type config struct {
+	window       time.Duration
+	buckets      int
+	minRequests  int
+	failureRatio float64
+	openTimeout  time.Duration
+	probes       int
+}
+
+type bucket struct {
+	// 桶对应的时间段的编号
+	index     int64
+	successes int
+	failures  int
+}
+
+// breaker 一个key的熔断器，失败率在滑动窗口里面统计
+type breaker struct {
+	mu       sync.Mutex
+	cfg      config
+	state    State
+	openedAt time.Time
+	buckets  []bucket
+	// 半开的时候正在执行和已经成功的探测请求
+	probing   int
+	succeeded int
+	// 第几次进入半开，探测请求的结果只对放行它的那一次半开有效
+	generation uint64
+	// 最后一次使用的时间，由 MiddlewareBuilder 的锁保护，用来清除不再使用的熔断器
+	lastUsed time.Time
+}
+
+func newBreaker(cfg config) *breaker {
+	return &breaker{cfg: cfg, buckets: make([]bucket, cfg.buckets)}
+}
+
+// allow 返回是否放行，探测请求返回半开的次数，不是探测请求返回0
+func (b *breaker) allow(now time.Time) (bool, uint64, *transition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var t *transition
+	if b.state == Open {
+		if now.Sub(b.openedAt) < b.cfg.openTimeout {
+			return false, 0, nil
+		}
+		t = b.setState(HalfOpen, now)
+	}
+	if b.state == HalfOpen {
+		if b.probing+b.succeeded >= b.cfg.probes {
+			return false, 0, t
+		}
+		b.probing++
+		return true, b.generation, t
+	}
+	return true, 0, t
+}
+
+// record 记录请求的结果，在打开之前放行的请求和之前的半开放行的探测请求的结果会被忽略
+func (b *breaker) record(now time.Time, failed bool, probe uint64) *transition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe != 0 {
+		if b.state != HalfOpen || probe != b.generation {
+			return nil
+		}
+		b.probing--
+		if failed {
+			return b.setState(Open, now)
+		}
+		b.succeeded++
+		if b.succeeded >= b.cfg.probes {
+			return b.setState(Closed, now)
+		}
+		return nil
+	}
+	if b.state != Closed {
+		return nil
+	}
+
+	bk := b.bucket(now)
+	if failed {
+		bk.failures++
+	} else {
+		bk.successes++
+	}
+	successes, failures := b.counts(now)
+	total := successes + failures
+	if total >= b.cfg.minRequests && float64(failures)/float64(total) >= b.cfg.failureRatio {
+		return b.setState(Open, now)
+	}
+	return nil
+}
+
+func (b *breaker) current() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *breaker) setState(state State, now time.Time) *transition {
+	t := &transition{from: b.state, to: state}
+	b.state = state
+	b.probing, b.succeeded = 0, 0
+	switch state {
+	case Open:
+		b.openedAt = now
+	case HalfOpen:
+		b.generation++
+	case Closed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+	return t
+}
+
+func (b *breaker) bucketWidth() time.Duration {
+	return b.cfg.window / time.Duration(b.cfg.buckets)
+}
+
+// bucket 当前时间对应的桶，过期的桶会被重置
+func (b *breaker) bucket(now time.Time) *bucket {
+	index := now.UnixNano() / int64(b.bucketWidth())
+	bk := &b.buckets[index%int64(len(b.buckets))]
+	if bk.index != index {
+		*bk = bucket{index: index}
+	}
+	return bk
+}
+
+// counts 窗口内的成功和失败次数
+func (b *breaker) counts(now time.Time) (int, int) {
+	oldest := now.UnixNano()/int64(b.bucketWidth()) - int64(len(b.buckets)) + 1
+	successes, failures := 0, 0
+	for _, bk := range b.buckets {
+		if bk.index >= oldest {
+			successes += bk.successes
+			failures += bk.failures
+		}
+	}
+	return successes, failures
+}
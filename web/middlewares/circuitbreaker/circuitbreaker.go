@@ -0,0 +1,227 @@
+package circuitbreaker
+
+import (
+	"WebFramework/web"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type MiddlewareBuilder struct {
+	cfg           config
+	keyFunc       func(c *web.Context) string
+	isFailure     func(c *web.Context) bool
+	fallback      web.HandleFunc
+	onStateChange func(key string, from, to State)
+	now           func() time.Time
+
+	// 指标
+	stateGauge  *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+
+	mu        sync.Mutex
+	breakers  map[string]*breaker
+	lastSweep time.Time
+}
+
+// NewBuilder 默认每个路由一个熔断器
+// 10秒的窗口内至少20个请求并且失败率达到50%的时候打开，5秒之后半开，1个探测请求成功之后关闭
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		cfg: config{
+			window:       10 * time.Second,
+			buckets:      10,
+			minRequests:  20,
+			failureRatio: 0.5,
+			openTimeout:  5 * time.Second,
+			probes:       1,
+		},
+		keyFunc: func(c *web.Context) string {
+			return c.Request.Method + " " + c.MatchedRoute
+		},
+		isFailure: IsServerError,
+		fallback: func(c *web.Context) {
+			// 提前设置响应码，外层的监控和日志中间件才能看到503
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			c.Error(web.NewHTTPError(http.StatusServiceUnavailable, ""))
+		},
+		now:      time.Now,
+		breakers: map[string]*breaker{},
+	}
+}
+
+// IsServerError 默认的失败判断：响应码大于等于500、记录了非 HTTPError 的错误、
+// 记录了响应码大于等于500的 HTTPError、或者超时
+func IsServerError(c *web.Context) bool {
+	if err := c.Err(); err != nil {
+		var httpErr *web.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr.Code >= http.StatusInternalServerError
+		}
+		return true
+	}
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		return true
+	}
+	return c.RespStatusCode >= http.StatusInternalServerError
+}
+
+// Key 自定义熔断的维度，例如按照下游服务
+// 关闭状态并且一个窗口内没有请求的熔断器会被清除，打开和半开的会一直保留，所以 key 的取值应该是有限的
+func (m *MiddlewareBuilder) Key(fn func(c *web.Context) string) *MiddlewareBuilder {
+	m.keyFunc = fn
+	return m
+}
+
+// Window 统计失败率的滑动窗口，分成 buckets 个桶，每个桶至少1纳秒
+func (m *MiddlewareBuilder) Window(window time.Duration, buckets int) *MiddlewareBuilder {
+	if buckets <= 0 {
+		panic(fmt.Sprintf("circuitbreaker: buckets must be positive, got %d", buckets))
+	}
+	if window < time.Duration(buckets) {
+		panic(fmt.Sprintf("circuitbreaker: window %s is shorter than %d buckets", window, buckets))
+	}
+	m.cfg.window = window
+	m.cfg.buckets = buckets
+	return m
+}
+
+// Threshold 窗口内至少 minRequests 个请求并且失败率达到 failureRatio 的时候打开
+func (m *MiddlewareBuilder) Threshold(minRequests int, failureRatio float64) *MiddlewareBuilder {
+	m.cfg.minRequests = minRequests
+	m.cfg.failureRatio = failureRatio
+	return m
+}
+
+// OpenTimeout 打开多久之后进入半开
+func (m *MiddlewareBuilder) OpenTimeout(timeout time.Duration) *MiddlewareBuilder {
+	m.cfg.openTimeout = timeout
+	return m
+}
+
+// HalfOpenProbes 半开的时候放行的探测请求数，全部成功之后关闭，任何一个失败重新打开
+func (m *MiddlewareBuilder) HalfOpenProbes(probes int) *MiddlewareBuilder {
+	m.cfg.probes = probes
+	return m
+}
+
+func (m *MiddlewareBuilder) IsFailure(fn func(c *web.Context) bool) *MiddlewareBuilder {
+	m.isFailure = fn
+	return m
+}
+
+// Fallback 打开的时候的降级响应，默认返回503
+func (m *MiddlewareBuilder) Fallback(fallback web.HandleFunc) *MiddlewareBuilder {
+	m.fallback = fallback
+	return m
+}
+
+// OnStateChange 状态变化的回调，可以用来告警
+func (m *MiddlewareBuilder) OnStateChange(fn func(key string, from, to State)) *MiddlewareBuilder {
+	m.onStateChange = fn
+	return m
+}
+
+// Metrics 导出 circuit_breaker_state（0关闭，1打开，2半开）、
+// circuit_breaker_transitions_total 和 circuit_breaker_rejected_total
+func (m *MiddlewareBuilder) Metrics(reg prometheus.Registerer, namespace string) *MiddlewareBuilder {
+	m.stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Current circuit breaker state: 0 closed, 1 open, 2 half-open",
+	}, []string{"key"})
+	m.transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Circuit breaker state transitions",
+	}, []string{"key", "from", "to"})
+	m.rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_rejected_total",
+		Help:      "Requests served by the fallback while the circuit breaker is open",
+	}, []string{"key"})
+	reg.MustRegister(m.stateGauge, m.transitions, m.rejected)
+	return m
+}
+
+// State 某个key当前的状态
+func (m *MiddlewareBuilder) State(key string) State {
+	m.mu.Lock()
+	b, ok := m.breakers[key]
+	m.mu.Unlock()
+	if !ok {
+		return Closed
+	}
+	return b.current()
+}
+
+// Build panic 算作失败，记录之后继续向上抛
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			key := m.keyFunc(c)
+			now := m.now()
+			b := m.breaker(key, now)
+			ok, probe, t := b.allow(now)
+			m.notify(key, t)
+			if !ok {
+				if m.rejected != nil {
+					m.rejected.WithLabelValues(key).Inc()
+				}
+				m.fallback(c)
+				return
+			}
+
+			failed := true
+			defer func() {
+				m.notify(key, b.record(m.now(), failed, probe))
+			}()
+			next(c)
+			failed = m.isFailure(c)
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) breaker(key string, now time.Time) *breaker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	b, ok := m.breakers[key]
+	if !ok {
+		b = newBreaker(m.cfg)
+		m.breakers[key] = b
+	}
+	b.lastUsed = now
+	return b
+}
+
+// sweep 每个窗口最多一次，清除关闭状态并且一个窗口内没有使用的熔断器，它们的统计已经全部过期了
+func (m *MiddlewareBuilder) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.cfg.window {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.breakers {
+		if now.Sub(b.lastUsed) >= m.cfg.window && b.current() == Closed {
+			delete(m.breakers, key)
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) notify(key string, t *transition) {
+	if t == nil {
+		return
+	}
+	if m.stateGauge != nil {
+		m.stateGauge.WithLabelValues(key).Set(float64(t.to))
+		m.transitions.WithLabelValues(key, t.from.String(), t.to.String()).Inc()
+	}
+	if m.onStateChange != nil {
+		m.onStateChange(key, t.from, t.to)
+	}
+}
@@ -0,0 +1,193 @@
+package circuitbreaker
+
+import (
+	"WebFramework/web"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	now := time.Now()
+	var transitions []string
+	reg := prometheus.NewRegistry()
+	builder := NewBuilder().Threshold(4, 0.5).OpenTimeout(time.Minute).HalfOpenProbes(2).
+		OnStateChange(func(key string, from, to State) {
+			transitions = append(transitions, key+": "+from.String()+" -> "+to.String())
+		}).
+		Metrics(reg, "test")
+	builder.now = func() time.Time { return now }
+
+	status, calls, observed := http.StatusOK, 0, 0
+	// 外层中间件看到的响应码
+	observer := func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			next(c)
+			observed = c.RespStatusCode
+		}
+	}
+	s := web.NewHttpServer(web.WithMiddleware(observer, builder.Build()))
+	s.Get("/order/:id", func(c *web.Context) {
+		calls++
+		c.RespStatusCode = status
+	})
+	s.Get("/user", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+	key := "GET /order/:id"
+
+	// 两次成功两次失败，达到50%
+	serve("/order/1")
+	serve("/order/2")
+	status = http.StatusInternalServerError
+	serve("/order/3")
+	assert.Equal(t, Closed, builder.State(key))
+	serve("/order/4")
+	assert.Equal(t, Open, builder.State(key))
+
+	// 打开之后不执行业务逻辑，其它路由不受影响
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/order/5"))
+	assert.Equal(t, http.StatusServiceUnavailable, observed)
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, http.StatusOK, serve("/user"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(builder.rejected.WithLabelValues(key)))
+
+	// 半开，探测失败重新打开
+	now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusInternalServerError, serve("/order/6"))
+	assert.Equal(t, Open, builder.State(key))
+
+	// 半开，两个探测都成功之后关闭
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, serve("/order/7"))
+	assert.Equal(t, HalfOpen, builder.State(key))
+	assert.Equal(t, http.StatusOK, serve("/order/8"))
+	assert.Equal(t, Closed, builder.State(key))
+	assert.Equal(t, float64(Closed), testutil.ToFloat64(builder.stateGauge.WithLabelValues(key)))
+
+	assert.Equal(t, []string{
+		key + ": closed -> open",
+		key + ": open -> half-open",
+		key + ": half-open -> open",
+		key + ": open -> half-open",
+		key + ": half-open -> closed",
+	}, transitions)
+	assert.Equal(t, float64(2), testutil.ToFloat64(builder.transitions.WithLabelValues(key, "open", "half-open")))
+}
+
+func TestMiddlewareBuilder_Failures(t *testing.T) {
+	now := time.Now()
+	builder := NewBuilder().Threshold(2, 1).Window(time.Second, 2).
+		Key(func(c *web.Context) string { return "downstream" }).
+		Fallback(func(c *web.Context) {
+			c.RespStatusCode = http.StatusOK
+			c.RespData = []byte("cached")
+		})
+	builder.now = func() time.Time { return now }
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
+	s.Get("/panic", func(c *web.Context) {
+		panic("boom")
+	})
+	s.Get("/error", func(c *web.Context) {
+		c.Error(errors.New("db down"))
+	})
+	s.Get("/bad-request", func(c *web.Context) {
+		c.Error(web.NewHTTPError(http.StatusBadRequest, ""))
+	})
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	// 4xx 不算失败
+	serve("/bad-request")
+	serve("/bad-request")
+	assert.Equal(t, Closed, builder.State("downstream"))
+
+	// 窗口过去之后重新统计
+	now = now.Add(2 * time.Second)
+	assert.Panics(t, func() { serve("/panic") })
+	assert.Equal(t, Closed, builder.State("downstream"))
+	serve("/error")
+	assert.Equal(t, Open, builder.State("downstream"))
+	assert.Equal(t, "cached", serve("/error").Body.String())
+}
+
+func TestMiddlewareBuilder_Window(t *testing.T) {
+	assert.Panics(t, func() { NewBuilder().Window(time.Second, 0) })
+	assert.Panics(t, func() { NewBuilder().Window(5*time.Nanosecond, 10) })
+	assert.NotPanics(t, func() { NewBuilder().Window(10*time.Nanosecond, 10) })
+}
+
+func TestMiddlewareBuilder_Sweep(t *testing.T) {
+	now := time.Now()
+	builder := NewBuilder().Key(func(c *web.Context) string {
+		return c.Request.URL.Path
+	}).Threshold(1, 0.5).OpenTimeout(time.Hour)
+	builder.now = func() time.Time { return now }
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
+	s.Get("/*", func(c *web.Context) {
+		if c.Request.URL.Path == "/broken" {
+			c.RespStatusCode = http.StatusInternalServerError
+		}
+	})
+	serve := func(path string) {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	serve("/a")
+	serve("/b")
+	serve("/broken")
+	assert.Len(t, builder.breakers, 3)
+	assert.Equal(t, Open, builder.State("/broken"))
+
+	// 过了一个窗口，没有再使用的关闭状态的熔断器被清除，打开的保留
+	now = now.Add(10 * time.Second)
+	serve("/b")
+	assert.Len(t, builder.breakers, 2)
+	assert.Contains(t, builder.breakers, "/b")
+	assert.Equal(t, Open, builder.State("/broken"))
+}
+
+func TestBreaker_StaleProbe(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(config{window: time.Second, buckets: 1, minRequests: 1, failureRatio: 0.5, openTimeout: time.Second, probes: 2})
+	b.record(now, true, 0)
+	assert.Equal(t, Open, b.current())
+
+	// 第一次半开放行两个探测请求，一个失败之后重新打开
+	now = now.Add(time.Second)
+	ok, stale, _ := b.allow(now)
+	assert.True(t, ok)
+	ok, probe, _ := b.allow(now)
+	assert.True(t, ok)
+	b.record(now, true, probe)
+	assert.Equal(t, Open, b.current())
+
+	// 第二次半开之后，上一次的探测请求才结束，结果不算数
+	now = now.Add(time.Second)
+	ok, probe, _ = b.allow(now)
+	assert.True(t, ok)
+	assert.NotEqual(t, stale, probe)
+	assert.Nil(t, b.record(now, false, stale))
+	assert.Equal(t, 1, b.probing)
+	assert.Equal(t, 0, b.succeeded)
+
+	b.record(now, false, probe)
+	assert.Equal(t, HalfOpen, b.current())
+	ok, probe, _ = b.allow(now)
+	assert.True(t, ok)
+	b.record(now, false, probe)
+	assert.Equal(t, Closed, b.current())
+}
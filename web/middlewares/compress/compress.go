@@ -0,0 +1,267 @@
+package compress
+
+import (
+	"WebFramework/web"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Encoder 创建压缩数据的 Writer，流式响应需要 Writer 实现 Flush() error
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+// Decoder 创建解压请求体的 Reader
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// Gzip level 使用 compress/gzip 的压缩级别
+func Gzip(level int) Encoder {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	}
+}
+
+// Deflate HTTP 的 deflate 是 zlib 格式（RFC 1950），不是裸的 deflate 数据，level 使用 compress/zlib 的压缩级别
+func Deflate(level int) Encoder {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriterLevel(w, level)
+	}
+}
+
+type encoding struct {
+	name    string
+	encoder Encoder
+}
+
+type MiddlewareBuilder struct {
+	// 按照注册的顺序，客户端的q值相同的时候优先使用前面的
+	encodings    []encoding
+	decoders     map[string]Decoder
+	minSize      int
+	contentTypes []string
+	maxBodySize  int64
+}
+
+// NewBuilder 默认支持gzip和deflate，压缩大于1KB的文本、JSON、JavaScript、XML和SVG
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		encodings: []encoding{
+			{name: "gzip", encoder: Gzip(gzip.DefaultCompression)},
+			{name: "deflate", encoder: Deflate(zlib.DefaultCompression)},
+		},
+		minSize: 1024,
+		contentTypes: []string{
+			"text/",
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"image/svg+xml",
+		},
+	}
+}
+
+// Register 注册压缩算法，name 是 Content-Encoding 的值，例如 zstd、br
+// 同名的算法会被替换
+func (m *MiddlewareBuilder) Register(name string, encoder Encoder) *MiddlewareBuilder {
+	for i, e := range m.encodings {
+		if e.name == name {
+			m.encodings[i].encoder = encoder
+			return m
+		}
+	}
+	m.encodings = append(m.encodings, encoding{name: name, encoder: encoder})
+	return m
+}
+
+// MinSize 小于 size 字节的响应不压缩
+func (m *MiddlewareBuilder) MinSize(size int) *MiddlewareBuilder {
+	m.minSize = size
+	return m
+}
+
+// ContentTypes 可以压缩的响应类型，以 / 结尾的是前缀，例如 text/
+func (m *MiddlewareBuilder) ContentTypes(types ...string) *MiddlewareBuilder {
+	m.contentTypes = types
+	return m
+}
+
+// DecompressRequest 解压 Content-Encoding 是gzip或者deflate的请求体，解压之后超过 maxBodySize 字节返回错误
+// 解压失败的请求返回400
+func (m *MiddlewareBuilder) DecompressRequest(maxBodySize int64) *MiddlewareBuilder {
+	m.maxBodySize = maxBodySize
+	m.decoders = map[string]Decoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+	}
+	return m
+}
+
+// RegisterDecoder 注册解压请求体的算法，需要先调用 DecompressRequest
+func (m *MiddlewareBuilder) RegisterDecoder(name string, decoder Decoder) *MiddlewareBuilder {
+	if m.decoders == nil {
+		m.decoders = map[string]Decoder{}
+	}
+	m.decoders[name] = decoder
+	return m
+}
+
+// Build 业务逻辑写到 RespData 的响应整体压缩，直接写 Writer 的响应流式压缩
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			if !m.decompress(c) {
+				return
+			}
+
+			enc, ok := m.negotiate(c.Request.Header.Get("Accept-Encoding"))
+			if !ok || c.Request.Method == http.MethodHead {
+				next(c)
+				return
+			}
+
+			original := c.Writer
+			w := &compressWriter{ResponseWriter: original, builder: m, enc: enc}
+			c.Writer = w
+			next(c)
+
+			if w.used {
+				// 流式响应已经写了响应头，后面的 flushResp 只能写响应体
+				if len(c.RespData) > 0 {
+					_, _ = w.Write(c.RespData)
+					c.RespData = nil
+				}
+				if err := w.Close(); err != nil {
+					c.Error(err)
+				}
+				c.Writer = headerWrittenWriter{ResponseWriter: original}
+				return
+			}
+			c.Writer = original
+			if err := m.compressResp(c, enc); err != nil {
+				c.Error(err)
+			}
+		}
+	}
+}
+
+// compressResp 压缩 RespData
+func (m MiddlewareBuilder) compressResp(c *web.Context, enc encoding) error {
+	header := c.Writer.Header()
+	if !m.compressible(header, c.RespStatusCode, c.RespData) {
+		return nil
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if len(c.RespData) < m.minSize {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	ew, err := enc.encoder(buf)
+	if err != nil {
+		return err
+	}
+	if _, err = ew.Write(c.RespData); err != nil {
+		return err
+	}
+	if err = ew.Close(); err != nil {
+		return err
+	}
+	header.Set("Content-Encoding", enc.name)
+	header.Del("Content-Length")
+	c.RespData = buf.Bytes()
+	return nil
+}
+
+// compressible 响应类型允许压缩并且没有被压缩过
+func (m MiddlewareBuilder) compressible(header http.Header, status int, data []byte) bool {
+	if header.Get("Content-Encoding") != "" ||
+		status == http.StatusNoContent || status == http.StatusNotModified ||
+		(status >= 100 && status < 200) {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		if len(data) == 0 {
+			return false
+		}
+		contentType = http.DetectContentType(data)
+		header.Set("Content-Type", contentType)
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range m.contentTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate 选择q值最高的算法，q值相同的时候按照注册的顺序
+func (m MiddlewareBuilder) negotiate(acceptEncoding string) (encoding, bool) {
+	if acceptEncoding == "" {
+		return encoding{}, false
+	}
+	qs := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		qs[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	var best encoding
+	bestQ := 0.0
+	for _, e := range m.encodings {
+		q, ok := qs[e.name]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// decompress 返回false表示请求体不能解压，已经记录了错误
+func (m MiddlewareBuilder) decompress(c *web.Context) bool {
+	if m.decoders == nil || c.Request.Body == nil {
+		return true
+	}
+	name := strings.ToLower(strings.TrimSpace(c.Request.Header.Get("Content-Encoding")))
+	if name == "" || name == "identity" {
+		return true
+	}
+	decoder, ok := m.decoders[name]
+	if !ok {
+		c.Error(web.NewHTTPError(http.StatusUnsupportedMediaType, "unsupported content encoding "+name))
+		return false
+	}
+	r, err := decoder(c.Request.Body)
+	if err != nil {
+		c.Error(web.NewHTTPError(http.StatusBadRequest, "invalid "+name+" body").Wrap(err))
+		return false
+	}
+	var body io.ReadCloser = r
+	if m.maxBodySize > 0 {
+		body = http.MaxBytesReader(c.Writer, r, m.maxBodySize)
+	}
+	c.Request.Body = body
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Del("Content-Length")
+	c.Request.ContentLength = -1
+	return true
+}
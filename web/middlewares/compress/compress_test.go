@@ -0,0 +1,363 @@
+package compress
+
+import (
+	"WebFramework/web"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+	testCases := []struct {
+		name           string
+		builder        *MiddlewareBuilder
+		method         string
+		acceptEncoding string
+		contentType    string
+		contentEncode  string
+		data           string
+
+		wantEncoding string
+		wantVary     string
+	}{
+		{
+			name:           "gzip",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip, deflate",
+			contentType:    "text/plain; charset=utf-8",
+			data:           large,
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "deflate by q",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip;q=0.5, deflate",
+			contentType:    "application/json",
+			data:           large,
+			wantEncoding:   "deflate",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "wildcard",
+			builder:        NewBuilder(),
+			acceptEncoding: "br, *;q=0.1",
+			contentType:    "text/html",
+			data:           large,
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "gzip refused",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip;q=0, deflate;q=0",
+			contentType:    "text/plain",
+			data:           large,
+		},
+		{
+			name:        "no accept encoding",
+			builder:     NewBuilder(),
+			contentType: "text/plain",
+			data:        large,
+		},
+		{
+			name:           "too small",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			data:           "hello",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "min size",
+			builder:        NewBuilder().MinSize(0),
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			data:           "hello",
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "content type not allowed",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			data:           large,
+		},
+		{
+			name:           "configured content types",
+			builder:        NewBuilder().ContentTypes("image/png"),
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			data:           large,
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "detect content type",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip",
+			data:           large,
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+		},
+		{
+			name:           "already encoded",
+			builder:        NewBuilder(),
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			contentEncode:  "br",
+			data:           large,
+			wantEncoding:   "br",
+		},
+		{
+			name:           "head",
+			builder:        NewBuilder(),
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			data:           large,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := web.NewHttpServer(web.WithMiddleware(tc.builder.Build()))
+			handler := func(c *web.Context) {
+				if tc.contentType != "" {
+					c.Writer.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.contentEncode != "" {
+					c.Writer.Header().Set("Content-Encoding", tc.contentEncode)
+				}
+				c.RespStatusCode = http.StatusOK
+				c.RespData = []byte(tc.data)
+			}
+			s.Get("/", handler)
+			s.Head("/", handler)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.wantEncoding, recorder.Header().Get("Content-Encoding"))
+			assert.Equal(t, tc.wantVary, recorder.Header().Get("Vary"))
+			if method == http.MethodHead {
+				return
+			}
+			assert.Equal(t, tc.data, decode(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Register(t *testing.T) {
+	identity := func(w io.Writer) (io.WriteCloser, error) {
+		return nopCloser{Writer: w}, nil
+	}
+	s := web.NewHttpServer(web.WithMiddleware(NewBuilder().MinSize(0).Register("custom", identity).Build()))
+	s.Get("/", func(c *web.Context) {
+		c.Writer.Header().Set("Content-Type", "text/plain")
+		c.RespData = []byte("hello")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, custom")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "custom", recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "hello", recorder.Body.String())
+}
+
+func TestMiddlewareBuilder_Stream(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler web.HandleFunc
+
+		wantCode     int
+		wantEncoding string
+		wantBody     string
+	}{
+		{
+			name: "flush",
+			handler: func(c *web.Context) {
+				c.Writer.Header().Set("Content-Type", "text/event-stream")
+				c.Writer.WriteHeader(http.StatusAccepted)
+				_, _ = c.Writer.Write([]byte("data: 1\n\n"))
+				c.Writer.(http.Flusher).Flush()
+				_, _ = c.Writer.Write([]byte("data: 2\n\n"))
+				c.RespData = []byte("data: 3\n\n")
+			},
+			wantCode:     http.StatusAccepted,
+			wantEncoding: "gzip",
+			wantBody:     "data: 1\n\ndata: 2\n\ndata: 3\n\n",
+		},
+		{
+			name: "large write",
+			handler: func(c *web.Context) {
+				c.Writer.Header().Set("Content-Type", "text/plain")
+				_, _ = c.Writer.Write([]byte(strings.Repeat("a", 2048)))
+			},
+			wantCode:     http.StatusOK,
+			wantEncoding: "gzip",
+			wantBody:     strings.Repeat("a", 2048),
+		},
+		{
+			name: "small write",
+			handler: func(c *web.Context) {
+				c.Writer.Header().Set("Content-Type", "text/plain")
+				_, _ = c.Writer.Write([]byte("hello"))
+			},
+			wantCode: http.StatusOK,
+			wantBody: "hello",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := web.NewHttpServer(web.WithMiddleware(NewBuilder().Build()))
+			s.Get("/", tc.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantEncoding, recorder.Header().Get("Content-Encoding"))
+			assert.Equal(t, tc.wantBody, decode(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
+
+func TestMiddlewareBuilder_DecompressRequest(t *testing.T) {
+	gzipped := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipped)
+	_, _ = gw.Write([]byte(`{"name":"Tom"}`))
+	require.NoError(t, gw.Close())
+	deflated := &bytes.Buffer{}
+	zw := zlib.NewWriter(deflated)
+	_, _ = zw.Write([]byte(`{"name":"Spike"}`))
+	require.NoError(t, zw.Close())
+
+	testCases := []struct {
+		name     string
+		builder  *MiddlewareBuilder
+		encoding string
+		body     []byte
+
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "gzip",
+			builder:  NewBuilder().DecompressRequest(0),
+			encoding: "gzip",
+			body:     gzipped.Bytes(),
+			wantCode: http.StatusOK,
+			wantBody: "Tom",
+		},
+		{
+			name:     "deflate",
+			builder:  NewBuilder().DecompressRequest(0),
+			encoding: "deflate",
+			body:     deflated.Bytes(),
+			wantCode: http.StatusOK,
+			wantBody: "Spike",
+		},
+		{
+			name:     "plain",
+			builder:  NewBuilder().DecompressRequest(0),
+			body:     []byte(`{"name":"Jerry"}`),
+			wantCode: http.StatusOK,
+			wantBody: "Jerry",
+		},
+		{
+			name:     "invalid gzip",
+			builder:  NewBuilder().DecompressRequest(0),
+			encoding: "gzip",
+			body:     []byte("not gzip"),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unsupported",
+			builder:  NewBuilder().DecompressRequest(0),
+			encoding: "br",
+			body:     []byte("data"),
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "too large",
+			builder:  NewBuilder().DecompressRequest(5),
+			encoding: "gzip",
+			body:     gzipped.Bytes(),
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := web.NewHttpServer(web.WithMiddleware(tc.builder.Build()))
+			s.Post("/user", func(c *web.Context) {
+				var u struct {
+					Name string `json:"name"`
+				}
+				if err := c.BindJSON(&u); err != nil {
+					c.RespStatusCode = http.StatusRequestEntityTooLarge
+					return
+				}
+				c.RespStatusCode = http.StatusOK
+				c.RespData = []byte(u.Name)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/user", bytes.NewReader(tc.body))
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, data []byte) string {
+	var r io.Reader = bytes.NewReader(data)
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		r = gr
+	case "deflate":
+		zr, err := zlib.NewReader(r)
+		require.NoError(t, err)
+		r = zr
+	}
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(res)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// compressWriter 业务逻辑直接写响应的时候使用
+// 先缓存到 minSize 再决定是否压缩，调用 Flush 的时候立刻决定
+type compressWriter struct {
+	http.ResponseWriter
+	builder MiddlewareBuilder
+	enc     encoding
+
+	// 业务逻辑是否直接写了响应
+	used    bool
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	ew      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	w.used = true
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.used = true
+	if w.decided {
+		return w.write(data)
+	}
+	w.buf.Write(data)
+	if w.buf.Len() >= w.builder.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.ew != nil {
+		return w.ew.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide 写响应头，然后把缓存的数据写出去，large 表示数据量达到了压缩的阈值
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if w.builder.compressible(header, status, w.buf.Bytes()) {
+		header.Add("Vary", "Accept-Encoding")
+		if large {
+			ew, err := w.enc.encoder(w.ResponseWriter)
+			if err != nil {
+				return err
+			}
+			w.ew = ew
+			header.Set("Content-Encoding", w.enc.name)
+			header.Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// Flush 流式响应即使没有达到阈值也压缩
+func (w *compressWriter) Flush() {
+	w.used = true
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ew.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close 写出剩下的数据，没有达到阈值的时候不压缩
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(w.buf.Len() >= w.builder.minSize); err != nil {
+			return err
+		}
+	}
+	if w.ew != nil {
+		return w.ew.Close()
+	}
+	return nil
+}
+
+// headerWrittenWriter 流式响应结束之后忽略 flushResp 再次写响应头
+type headerWrittenWriter struct {
+	http.ResponseWriter
+}
+
+func (headerWrittenWriter) WriteHeader(int) {}
@@ -0,0 +1,169 @@
+package cors
+
+import (
+	"WebFramework/web"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MiddlewareBuilder struct {
+	allowOrigins     []string
+	allowOriginFunc  func(origin string) bool
+	allowMethods     []string
+	allowHeaders     []string
+	exposeHeaders    []string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// NewBuilder 需要通过 web.WithMiddleware 注册成server级别的中间件
+// 预检请求的 OPTIONS 一般没有注册路由，路由中间件处理不到
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{}
+}
+
+// AllowOrigins 允许的来源，支持完整的来源 https://example.com、
+// 子域名通配 https://*.example.com 和允许所有来源的 *
+func (m *MiddlewareBuilder) AllowOrigins(origins ...string) *MiddlewareBuilder {
+	m.allowOrigins = append(m.allowOrigins, origins...)
+	return m
+}
+
+// AllowOriginFunc 自定义来源检查，和 AllowOrigins 满足一个就可以
+func (m *MiddlewareBuilder) AllowOriginFunc(fn func(origin string) bool) *MiddlewareBuilder {
+	m.allowOriginFunc = fn
+	return m
+}
+
+// AllowMethods 允许的method，不设置的时候使用路径上注册了的method
+func (m *MiddlewareBuilder) AllowMethods(methods ...string) *MiddlewareBuilder {
+	for _, method := range methods {
+		m.allowMethods = append(m.allowMethods, strings.ToUpper(method))
+	}
+	return m
+}
+
+// AllowHeaders 允许的请求头，不设置的时候允许预检请求里面的所有请求头
+func (m *MiddlewareBuilder) AllowHeaders(headers ...string) *MiddlewareBuilder {
+	m.allowHeaders = append(m.allowHeaders, headers...)
+	return m
+}
+
+// ExposeHeaders 浏览器里面的脚本可以读取的响应头
+func (m *MiddlewareBuilder) ExposeHeaders(headers ...string) *MiddlewareBuilder {
+	m.exposeHeaders = append(m.exposeHeaders, headers...)
+	return m
+}
+
+// AllowCredentials 允许携带cookie，只会返回匹配上的来源，不能和 AllowOrigins("*") 一起使用
+func (m *MiddlewareBuilder) AllowCredentials() *MiddlewareBuilder {
+	m.allowCredentials = true
+	return m
+}
+
+// MaxAge 浏览器缓存预检结果的时间
+func (m *MiddlewareBuilder) MaxAge(maxAge time.Duration) *MiddlewareBuilder {
+	m.maxAge = maxAge
+	return m
+}
+
+// Build 同时允许所有来源和携带cookie的时候 panic，这样任何网站都可以带着用户的cookie读取响应
+func (m MiddlewareBuilder) Build() web.Middleware {
+	if m.allowCredentials && contains(m.allowOrigins, "*") {
+		panic("cors: AllowOrigins(\"*\") cannot be used with AllowCredentials")
+	}
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			origin := c.Request.Header.Get("Origin")
+			header := c.Writer.Header()
+			preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != ""
+			header.Add("Vary", "Origin")
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				next(c)
+				return
+			}
+			allowed := m.originAllowed(origin)
+			if !preflight {
+				if allowed {
+					m.setOrigin(header, origin)
+					if len(m.exposeHeaders) > 0 {
+						header.Set("Access-Control-Expose-Headers", strings.Join(m.exposeHeaders, ", "))
+					}
+				}
+				next(c)
+				return
+			}
+
+			// 预检请求不会执行后面的中间件和业务逻辑
+			method := strings.ToUpper(c.Request.Header.Get("Access-Control-Request-Method"))
+			methods := m.allowMethods
+			if len(methods) == 0 {
+				methods = c.AllowedMethods()
+			}
+			if !allowed || !contains(methods, method) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			m.setOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(m.allowHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(m.allowHeaders, ", "))
+			} else if reqHeaders := c.Request.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if m.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(m.maxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+		}
+	}
+}
+
+func (m MiddlewareBuilder) setOrigin(header http.Header, origin string) {
+	if m.allowCredentials {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	if contains(m.allowOrigins, "*") {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+}
+
+func (m MiddlewareBuilder) originAllowed(origin string) bool {
+	for _, allow := range m.allowOrigins {
+		if allow == "*" || strings.EqualFold(allow, origin) || matchWildcard(allow, origin) {
+			return true
+		}
+	}
+	return m.allowOriginFunc != nil && m.allowOriginFunc(origin)
+}
+
+// matchWildcard https://*.example.com 匹配 https://a.example.com 和 https://a.b.example.com，不匹配 https://example.com
+func matchWildcard(pattern, origin string) bool {
+	prefix, suffix, ok := strings.Cut(strings.ToLower(pattern), "*")
+	if !ok {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+		strings.HasPrefix(suffix, ".")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package cors
+
+import (
+	"WebFramework/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder *MiddlewareBuilder
+		method  string
+		headers map[string]string
+
+		wantCode    int
+		wantHeaders map[string]string
+		wantBody    string
+	}{
+		{
+			name:        "no origin",
+			builder:     NewBuilder().AllowOrigins("https://example.com"),
+			method:      http.MethodGet,
+			wantCode:    200,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+			wantBody:    "user",
+		},
+		{
+			name:        "simple request",
+			builder:     NewBuilder().AllowOrigins("https://example.com").ExposeHeaders("X-Trace-Id"),
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://example.com"},
+			wantCode:    200,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Expose-Headers": "X-Trace-Id"},
+			wantBody:    "user",
+		},
+		{
+			name:        "origin not allowed",
+			builder:     NewBuilder().AllowOrigins("https://example.com"),
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://evil.com"},
+			wantCode:    200,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantBody:    "user",
+		},
+		{
+			name:        "any origin",
+			builder:     NewBuilder().AllowOrigins("*"),
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://evil.com"},
+			wantCode:    200,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+			wantBody:    "user",
+		},
+		{
+			name:    "credentials",
+			builder: NewBuilder().AllowOrigins("https://*.a.com").AllowCredentials(),
+			method:  http.MethodGet,
+			headers: map[string]string{"Origin": "https://app.a.com"},
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.a.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			wantCode: 200,
+			wantBody: "user",
+		},
+		{
+			name:    "credentials origin not allowed",
+			builder: NewBuilder().AllowOrigins("https://*.a.com").AllowCredentials(),
+			method:  http.MethodGet,
+			headers: map[string]string{"Origin": "https://evil.com"},
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+			},
+			wantCode: 200,
+			wantBody: "user",
+		},
+		{
+			name:    "preflight",
+			builder: NewBuilder().AllowOrigins("https://*.example.com").MaxAge(10 * time.Minute),
+			method:  http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Content-Type, X-Token",
+			},
+			wantCode: 204,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-Token",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:    "preflight configured",
+			builder: NewBuilder().AllowOriginFunc(func(origin string) bool { return origin == "https://b.com" }).AllowMethods("put").AllowHeaders("X-Token"),
+			method:  http.MethodOptions,
+			headers: map[string]string{"Origin": "https://b.com", "Access-Control-Request-Method": "PUT"},
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "PUT",
+				"Access-Control-Allow-Headers": "X-Token",
+			},
+			wantCode: 204,
+		},
+		{
+			name:     "preflight method not allowed",
+			builder:  NewBuilder().AllowOrigins("*"),
+			method:   http.MethodOptions,
+			headers:  map[string]string{"Origin": "https://a.com", "Access-Control-Request-Method": "DELETE"},
+			wantCode: 403,
+		},
+		{
+			name:     "preflight wildcard requires subdomain",
+			builder:  NewBuilder().AllowOrigins("https://*.example.com"),
+			method:   http.MethodOptions,
+			headers:  map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET"},
+			wantCode: 403,
+		},
+		{
+			name:        "plain options",
+			builder:     NewBuilder().AllowOrigins("*"),
+			method:      http.MethodOptions,
+			wantCode:    204,
+			wantHeaders: map[string]string{"Allow": "GET, POST, OPTIONS"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := web.NewHttpServer(web.WithMiddleware(tc.builder.Build()))
+			handler := func(c *web.Context) {
+				c.RespStatusCode = http.StatusOK
+				c.RespData = []byte("user")
+			}
+			s.Get("/user/:id", handler)
+			s.Post("/user/:id", handler)
+
+			req := httptest.NewRequest(tc.method, "/user/1", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			for k, v := range tc.wantHeaders {
+				assert.Equal(t, v, recorder.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_AnyOriginWithCredentials(t *testing.T) {
+	// 不能把任意来源原样返回并且允许携带cookie
+	assert.Panics(t, func() {
+		NewBuilder().AllowOrigins("*").AllowCredentials().Build()
+	})
+	assert.Panics(t, func() {
+		NewBuilder().AllowCredentials().AllowOrigins("https://a.com", "*").Build()
+	})
+}
@@ -1,9 +1,19 @@
 package errhandle
 
-import "WebFramework/web"
+import (
+	"WebFramework/web"
+	"errors"
+)
 
 type MiddlewareBuilder struct {
 	resp map[int][]byte
+	errs []errResp
+}
+
+type errResp struct {
+	target error
+	status int
+	data   []byte
 }
 
 func NewBuilder() *MiddlewareBuilder {
@@ -17,13 +27,42 @@ func (m *MiddlewareBuilder) AddCode(status int, data []byte) *MiddlewareBuilder
 	return m
 }
 
+// AddError 业务逻辑返回的错误满足 errors.Is 的时候，使用指定的响应码和响应
+func (m *MiddlewareBuilder) AddError(target error, status int, data []byte) *MiddlewareBuilder {
+	m.errs = append(m.errs, errResp{target: target, status: status, data: data})
+	return m
+}
+
 func (m *MiddlewareBuilder) Build() web.Middleware {
 	return func(next web.HandleFunc) web.HandleFunc {
 		return func(c *web.Context) {
 			next(c)
+			if err := c.Err(); err != nil {
+				for _, e := range m.errs {
+					if errors.Is(err, e.target) {
+						m.replace(c, e.status, e.data)
+						return
+					}
+				}
+				// HTTPError 按照它自己的响应码来匹配
+				var httpErr *web.HTTPError
+				if errors.As(err, &httpErr) {
+					if data, ok := m.resp[httpErr.Code]; ok {
+						m.replace(c, httpErr.Code, data)
+						return
+					}
+				}
+			}
 			if data, ok := m.resp[c.RespStatusCode]; ok {
-				c.RespData = data
+				m.replace(c, c.RespStatusCode, data)
 			}
 		}
 	}
 }
+
+// replace 替换响应，之前设置的Content-Type不一定适用了
+func (m *MiddlewareBuilder) replace(c *web.Context, status int, data []byte) {
+	c.Writer.Header().Del("Content-Type")
+	c.RespStatusCode = status
+	c.RespData = data
+}
@@ -2,7 +2,11 @@ package errhandle
 
 import (
 	"WebFramework/web"
+	"WebFramework/web/webtest"
+	"errors"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -24,5 +28,52 @@ func TestMiddlewareBuilder_Build(t *testing.T) {
 `))
 
 	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
-	_ = s.Start(":8080")
+	s.Get("/user", func(c *web.Context) {
+		c.RespStatusCode = http.StatusBadRequest
+		c.RespData = []byte("bad request")
+	})
+	s.Get("/ok", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte("ok")
+	})
+
+	client := webtest.New(t, s)
+	client.Get("/unknown").Expect().Status(http.StatusNotFound).BodyContains("哈哈哈，走失了")
+	client.Get("/user").Expect().Status(http.StatusBadRequest).BodyContains("请求不对")
+	client.Get("/ok").Expect().Status(http.StatusOK).Body("ok")
+}
+
+func TestMiddlewareBuilder_BuildWithError(t *testing.T) {
+	errUserNotFound := errors.New("user not found")
+	builder := NewBuilder().
+		AddCode(http.StatusNotFound, []byte("404 page")).
+		AddCode(http.StatusForbidden, []byte("403 page")).
+		AddError(errUserNotFound, http.StatusGone, []byte("user gone"))
+
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
+	s.Get("/user", web.WrapE(func(c *web.Context) error {
+		return errUserNotFound
+	}))
+	s.Get("/admin", web.WrapE(func(c *web.Context) error {
+		return web.NewHTTPError(http.StatusForbidden, "forbidden")
+	}))
+
+	testcase := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "errors.Is", path: "/user", wantCode: http.StatusGone, wantBody: "user gone"},
+		{name: "http error", path: "/admin", wantCode: http.StatusForbidden, wantBody: "403 page"},
+		{name: "status code", path: "/unknown", wantCode: http.StatusNotFound, wantBody: "404 page"},
+	}
+	for _, tt := range testcase {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			assert.Equal(t, tt.wantBody, recorder.Body.String())
+		})
+	}
 }
@@ -0,0 +1,140 @@
+package etag
+
+import (
+	"WebFramework/web"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Strong 把 tag 转换成强 ETag，例如 "abc"
+func Strong(tag string) string {
+	return `"` + tag + `"`
+}
+
+// Weak 把 tag 转换成弱 ETag，例如 W/"abc"
+func Weak(tag string) string {
+	return `W/"` + tag + `"`
+}
+
+// Check 业务逻辑在生成响应之前设置 ETag 和 Last-Modified 并检查条件请求
+// etag 是 Strong 或者 Weak 的结果，为空或者 modTime 是零值的时候不设置对应的响应头
+// 返回true表示已经设置了304或者412的响应，业务逻辑不需要再生成响应
+// 修改资源的请求应该在修改之前调用，这样 If-Match 不满足的时候不会修改资源
+func Check(c *web.Context, etag string, modTime time.Time) bool {
+	header := c.Writer.Header()
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	return evaluate(c, etag, modTime)
+}
+
+// evaluate 按照 RFC 9110 13.2.2 的顺序检查条件请求，返回true表示已经设置了响应
+func evaluate(c *web.Context, etag string, modTime time.Time) bool {
+	header := c.Request.Header
+	if im := header.Get("If-Match"); im != "" {
+		if !matchAny(im, etag, strongMatch) {
+			return preconditionFailed(c)
+		}
+	} else if ius := parseTime(header.Get("If-Unmodified-Since")); !ius.IsZero() && !modTime.IsZero() {
+		if modTime.Truncate(time.Second).After(ius) {
+			return preconditionFailed(c)
+		}
+	}
+
+	get := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+	if inm := header.Get("If-None-Match"); inm != "" {
+		if matchAny(inm, etag, weakMatch) {
+			if get {
+				return notModified(c)
+			}
+			return preconditionFailed(c)
+		}
+	} else if ims := parseTime(header.Get("If-Modified-Since")); get && !ims.IsZero() && !modTime.IsZero() {
+		if !modTime.Truncate(time.Second).After(ims) {
+			return notModified(c)
+		}
+	}
+	return false
+}
+
+func notModified(c *web.Context) bool {
+	header := c.Writer.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	c.RespStatusCode = http.StatusNotModified
+	c.RespData = nil
+	return true
+}
+
+func preconditionFailed(c *web.Context) bool {
+	c.RespData = nil
+	c.Error(web.NewHTTPError(http.StatusPreconditionFailed, ""))
+	return true
+}
+
+func parseTime(val string) time.Time {
+	if val == "" {
+		return time.Time{}
+	}
+	t, err := http.ParseTime(val)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// matchAny header 是 * 或者逗号分隔的 ETag 列表
+func matchAny(header, etag string, match func(a, b string) bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		tag, rest, ok := scanETag(header)
+		if !ok {
+			return false
+		}
+		if match(tag, etag) {
+			return true
+		}
+		header = rest
+	}
+	return false
+}
+
+// scanETag 读取开头的一个 ETag，返回 ETag 和剩下的部分
+func scanETag(s string) (string, string, bool) {
+	if s == "" {
+		return "", "", true
+	}
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s) < start+2 || s[start] != '"' {
+		return "", "", false
+	}
+	end := strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", "", false
+	}
+	end += start + 2
+	return s[:end], s[end:], true
+}
+
+// strongMatch 两个都不是弱 ETag 并且相同
+func strongMatch(a, b string) bool {
+	return !strings.HasPrefix(a, "W/") && !strings.HasPrefix(b, "W/") && a == b
+}
+
+// weakMatch 忽略 W/ 之后相同
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
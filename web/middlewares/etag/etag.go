@@ -0,0 +1,89 @@
+package etag
+
+import (
+	"WebFramework/web"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash/crc32"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+)
+
+// Hasher 根据响应体计算 ETag 的值，不包含引号
+type Hasher func(data []byte) string
+
+// FNV 64位的 FNV-1a，速度快，默认使用
+func FNV(data []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 36) + "-" + strconv.Itoa(len(data))
+}
+
+// CRC32 IEEE 的 CRC32
+func CRC32(data []byte) string {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE(data)), 36) + "-" + strconv.Itoa(len(data))
+}
+
+// SHA256 碰撞的概率最小，适合需要强 ETag 的场景
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type MiddlewareBuilder struct {
+	hasher Hasher
+	weak   bool
+}
+
+// NewBuilder 默认使用 FNV 计算强 ETag
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{hasher: FNV}
+}
+
+// Hasher 计算 ETag 的算法
+func (m *MiddlewareBuilder) Hasher(hasher Hasher) *MiddlewareBuilder {
+	m.hasher = hasher
+	return m
+}
+
+// Weak 生成弱 ETag，响应体在语义上相同但是字节可能不同的时候使用，例如之后还会压缩
+func (m *MiddlewareBuilder) Weak() *MiddlewareBuilder {
+	m.weak = true
+	return m
+}
+
+// Build 只处理GET和HEAD的200响应
+// 业务逻辑已经设置了 ETag 响应头的时候不再计算，修改资源的请求需要业务逻辑自己调用 Check
+// HEAD 请求没有设置响应体的时候不计算，否则和GET的 ETag 对不上
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			next(c)
+			if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				return
+			}
+			if c.Err() != nil || (c.RespStatusCode != 0 && c.RespStatusCode != http.StatusOK) {
+				return
+			}
+
+			header := c.Writer.Header()
+			etag := header.Get("ETag")
+			if etag == "" {
+				if c.Request.Method == http.MethodHead && len(c.RespData) == 0 {
+					return
+				}
+				etag = m.tag(c.RespData)
+				header.Set("ETag", etag)
+			}
+			evaluate(c, etag, parseTime(header.Get("Last-Modified")))
+		}
+	}
+}
+
+func (m MiddlewareBuilder) tag(data []byte) string {
+	if m.weak {
+		return Weak(m.hasher(data))
+	}
+	return Strong(m.hasher(data))
+}
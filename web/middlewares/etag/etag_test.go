@@ -0,0 +1,281 @@
+package etag
+
+import (
+	"WebFramework/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	body := []byte("hello world")
+	strong := Strong(FNV(body))
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		builder *MiddlewareBuilder
+		method  string
+		headers map[string]string
+		status  int
+
+		wantCode int
+		wantETag string
+		wantBody string
+	}{
+		{
+			name:     "set etag",
+			builder:  NewBuilder(),
+			wantCode: http.StatusOK,
+			wantETag: strong,
+			wantBody: "hello world",
+		},
+		{
+			name:     "weak",
+			builder:  NewBuilder().Weak().Hasher(SHA256),
+			wantCode: http.StatusOK,
+			wantETag: Weak(SHA256(body)),
+			wantBody: "hello world",
+		},
+		{
+			name:     "if none match",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-None-Match": `"other", ` + strong},
+			wantCode: http.StatusNotModified,
+			wantETag: strong,
+		},
+		{
+			name:     "if none match weak comparison",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-None-Match": "W/" + strong},
+			wantCode: http.StatusNotModified,
+			wantETag: strong,
+		},
+		{
+			name:     "if none match changed",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-None-Match": `"other"`},
+			wantCode: http.StatusOK,
+			wantETag: strong,
+			wantBody: "hello world",
+		},
+		{
+			name:     "if none match star",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusNotModified,
+			wantETag: strong,
+		},
+		{
+			name:     "if match",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-Match": strong},
+			wantCode: http.StatusOK,
+			wantETag: strong,
+			wantBody: "hello world",
+		},
+		{
+			name:     "if match failed",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-Match": `"other"`},
+			wantCode: http.StatusPreconditionFailed,
+			wantETag: strong,
+			wantBody: "Precondition Failed",
+		},
+		{
+			name:     "if match weak",
+			builder:  NewBuilder().Weak(),
+			headers:  map[string]string{"If-Match": Weak(FNV(body))},
+			wantCode: http.StatusPreconditionFailed,
+			wantETag: Weak(FNV(body)),
+			wantBody: "Precondition Failed",
+		},
+		{
+			name:     "if modified since",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)},
+			wantCode: http.StatusNotModified,
+			wantETag: strong,
+		},
+		{
+			name:     "modified",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-Modified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)},
+			wantCode: http.StatusOK,
+			wantETag: strong,
+			wantBody: "hello world",
+		},
+		{
+			name:    "if none match takes precedence",
+			builder: NewBuilder(),
+			headers: map[string]string{
+				"If-None-Match":     `"other"`,
+				"If-Modified-Since": modTime.Format(http.TimeFormat),
+			},
+			wantCode: http.StatusOK,
+			wantETag: strong,
+			wantBody: "hello world",
+		},
+		{
+			name:     "if unmodified since",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-Unmodified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)},
+			wantCode: http.StatusPreconditionFailed,
+			wantETag: strong,
+			wantBody: "Precondition Failed",
+		},
+		{
+			name:     "not ok status",
+			builder:  NewBuilder(),
+			headers:  map[string]string{"If-None-Match": "*"},
+			status:   http.StatusCreated,
+			wantCode: http.StatusCreated,
+			wantBody: "hello world",
+		},
+		{
+			name:     "post",
+			builder:  NewBuilder(),
+			method:   http.MethodPost,
+			headers:  map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusOK,
+			wantBody: "hello world",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := web.NewHttpServer(web.WithMiddleware(tc.builder.Build()))
+			handler := func(c *web.Context) {
+				c.Writer.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+				c.RespStatusCode = tc.status
+				if c.RespStatusCode == 0 {
+					c.RespStatusCode = http.StatusOK
+				}
+				c.RespData = body
+			}
+			s.Get("/", handler)
+			s.Post("/", handler)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantETag, recorder.Header().Get("ETag"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Head(t *testing.T) {
+	s := web.NewHttpServer(web.WithMiddleware(NewBuilder().Build()))
+	get := func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte("hello world")
+	}
+	s.Get("/same", get)
+	s.Head("/same", get)
+	// 只设置响应头的HEAD处理不知道响应体，不能生成 ETag
+	s.Head("/empty", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder
+	}
+	assert.Equal(t, serve(http.MethodGet, "/same").Header().Get("ETag"), serve(http.MethodHead, "/same").Header().Get("ETag"))
+	recorder := serve(http.MethodHead, "/empty")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "", recorder.Header().Get("ETag"))
+}
+
+func TestCheck(t *testing.T) {
+	etag := Strong("v2")
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+
+		wantCode      int
+		wantGenerated bool
+	}{
+		{
+			name:          "no condition",
+			method:        http.MethodGet,
+			wantCode:      http.StatusOK,
+			wantGenerated: true,
+		},
+		{
+			name:     "not modified",
+			method:   http.MethodGet,
+			headers:  map[string]string{"If-None-Match": etag},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "put stale",
+			method:   http.MethodPut,
+			headers:  map[string]string{"If-Match": Strong("v1")},
+			wantCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:          "put fresh",
+			method:        http.MethodPut,
+			headers:       map[string]string{"If-Match": etag},
+			wantCode:      http.StatusOK,
+			wantGenerated: true,
+		},
+		{
+			name:     "put if none match",
+			method:   http.MethodPut,
+			headers:  map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:          "put if modified since ignored",
+			method:        http.MethodPut,
+			headers:       map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)},
+			wantCode:      http.StatusOK,
+			wantGenerated: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			generated := false
+			s := web.NewHttpServer(web.WithMiddleware(NewBuilder().Build()))
+			handler := func(c *web.Context) {
+				if Check(c, etag, modTime) {
+					return
+				}
+				generated = true
+				c.RespStatusCode = http.StatusOK
+				c.RespData = []byte("resource")
+			}
+			s.Get("/", handler)
+			s.Put("/", handler)
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantGenerated, generated)
+			assert.Equal(t, etag, recorder.Header().Get("ETag"))
+			assert.Equal(t, modTime.Format(http.TimeFormat), recorder.Header().Get("Last-Modified"))
+		})
+	}
+}
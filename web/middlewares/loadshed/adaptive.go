@@ -0,0 +1,115 @@
+package loadshed
+
+import (
+	"math"
+	"time"
+)
+
+// Adaptive 根据观察到的延迟调整并发上限，NewBuilder 的 limit 是初始值
+type Adaptive interface {
+	// newController 每个限制器使用单独的状态
+	newController(initial int) controller
+}
+
+type controller interface {
+	// update 请求结束的时候调用，返回新的上限
+	update(limit int, latency time.Duration, inFlight int) int
+}
+
+// AIMD 延迟超过 Threshold 的时候上限乘以 Backoff，否则在并发用到一半以上的时候上限加1
+type AIMD struct {
+	Threshold time.Duration
+	// Backoff 默认0.9
+	Backoff float64
+	// Min 默认1，Max 默认是初始上限的10倍
+	Min int
+	Max int
+}
+
+func (a AIMD) newController(initial int) controller {
+	if a.Backoff <= 0 || a.Backoff >= 1 {
+		a.Backoff = 0.9
+	}
+	a.Min, a.Max = bounds(a.Min, a.Max, initial)
+	return a
+}
+
+func (a AIMD) update(limit int, latency time.Duration, inFlight int) int {
+	if latency > a.Threshold {
+		return clamp(int(float64(limit)*a.Backoff), a.Min, a.Max)
+	}
+	if inFlight*2 >= limit {
+		return clamp(limit+1, a.Min, a.Max)
+	}
+	return limit
+}
+
+// Gradient 比较短期和长期的平均延迟，短期延迟升高说明开始排队，按照比例降低上限
+// 延迟稳定的时候上限以 sqrt(limit) 的速度增长
+type Gradient struct {
+	// Tolerance 短期延迟是长期延迟的多少倍以内不降低上限，默认1.5
+	Tolerance float64
+	// Smoothing 每次调整的幅度，默认0.2
+	Smoothing float64
+	// Min 默认1，Max 默认是初始上限的10倍
+	Min int
+	Max int
+}
+
+func (g Gradient) newController(initial int) controller {
+	if g.Tolerance < 1 {
+		g.Tolerance = 1.5
+	}
+	if g.Smoothing <= 0 || g.Smoothing > 1 {
+		g.Smoothing = 0.2
+	}
+	g.Min, g.Max = bounds(g.Min, g.Max, initial)
+	return &gradientController{cfg: g, estimate: float64(initial)}
+}
+
+type gradientController struct {
+	cfg Gradient
+	// 长期和短期的延迟，指数加权平均
+	longRTT  float64
+	shortRTT float64
+	estimate float64
+}
+
+func (g *gradientController) update(limit int, latency time.Duration, inFlight int) int {
+	rtt := float64(latency)
+	if g.longRTT == 0 {
+		g.longRTT, g.shortRTT = rtt, rtt
+	}
+	g.longRTT = g.longRTT*0.95 + rtt*0.05
+	g.shortRTT = g.shortRTT*0.5 + rtt*0.5
+
+	// 并发没有用到一半的时候延迟不能说明问题，不调整
+	if inFlight*2 < limit && g.shortRTT <= g.longRTT {
+		return limit
+	}
+	gradient := math.Max(0.5, math.Min(1, g.cfg.Tolerance*g.longRTT/g.shortRTT))
+	target := g.estimate*gradient + math.Sqrt(g.estimate)
+	g.estimate = g.estimate*(1-g.cfg.Smoothing) + target*g.cfg.Smoothing
+	g.estimate = math.Max(float64(g.cfg.Min), math.Min(float64(g.cfg.Max), g.estimate))
+	return int(g.estimate)
+}
+
+func bounds(min, max, initial int) (int, int) {
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = initial * 10
+	}
+	return min, max
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
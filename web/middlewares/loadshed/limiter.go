@@ -0,0 +1,117 @@
+package loadshed
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter 限制并发，超过上限的请求按照优先级排队
+type limiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	// 按照优先级从高到低排序，相同优先级先进先出
+	queue     []*waiter
+	queueSize int
+	ctrl      controller
+}
+
+type waiter struct {
+	priority Priority
+	// true 表示拿到了名额，false 表示被更高优先级的请求挤出了队列
+	ready chan bool
+}
+
+func newLimiter(limit, queueSize int, adaptive Adaptive) *limiter {
+	l := &limiter{limit: limit, queueSize: queueSize}
+	if adaptive != nil {
+		l.ctrl = adaptive.newController(limit)
+	}
+	return l
+}
+
+// acquire 返回false表示请求被拒绝
+func (l *limiter) acquire(ctx context.Context, priority Priority, timeout time.Duration) bool {
+	l.mu.Lock()
+	if priority == Critical || l.inFlight < l.limit {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if l.queueSize <= 0 {
+		l.mu.Unlock()
+		return false
+	}
+	if len(l.queue) >= l.queueSize {
+		// 挤掉队列里面优先级最低的
+		last := l.queue[len(l.queue)-1]
+		if last.priority >= priority {
+			l.mu.Unlock()
+			return false
+		}
+		l.queue = l.queue[:len(l.queue)-1]
+		last.ready <- false
+	}
+	w := &waiter{priority: priority, ready: make(chan bool, 1)}
+	i := len(l.queue)
+	for i > 0 && l.queue[i-1].priority < priority {
+		i--
+	}
+	l.queue = append(l.queue, nil)
+	copy(l.queue[i+1:], l.queue[i:])
+	l.queue[i] = w
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ok := <-w.ready:
+		return ok
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, qw := range l.queue {
+		if qw == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return false
+		}
+	}
+	// 超时的同时拿到了名额
+	return <-w.ready
+}
+
+// release 请求结束，自适应模式下根据延迟调整上限，然后唤醒排队的请求
+func (l *limiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctrl != nil {
+		l.limit = l.ctrl.update(l.limit, latency, l.inFlight)
+	}
+	l.done()
+}
+
+// cancel 拿到了名额但是没有执行，不参与调整上限
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done()
+}
+
+func (l *limiter) done() {
+	l.inFlight--
+	for len(l.queue) > 0 && l.inFlight < l.limit {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		l.inFlight++
+		w.ready <- true
+	}
+}
+
+func (l *limiter) stats() (inFlight, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight, l.limit
+}
@@ -0,0 +1,151 @@
+package loadshed
+
+import (
+	"WebFramework/web"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Priority 请求的优先级，排队的时候优先级高的先执行，队列满了的时候挤掉优先级低的
+type Priority int
+
+const (
+	Low Priority = iota
+	Normal
+	High
+	// Critical 不受并发限制，例如健康检查
+	Critical
+)
+
+// PriorityByRoute 按照匹配到的路由决定优先级，其它路由使用 fallback
+func PriorityByRoute(routes map[string]Priority, fallback Priority) func(c *web.Context) Priority {
+	return func(c *web.Context) Priority {
+		if p, ok := routes[c.MatchedRoute]; ok {
+			return p
+		}
+		return fallback
+	}
+}
+
+type MiddlewareBuilder struct {
+	limit        int
+	routeLimit   int
+	queueSize    int
+	queueTimeout time.Duration
+	adaptive     Adaptive
+	priority     func(c *web.Context) Priority
+
+	global   *limiter
+	routesMu sync.Mutex
+	routes   map[string]*limiter
+}
+
+// NewBuilder limit 是全局的并发上限，0表示不限制全局并发
+// 超过上限并且不能排队的请求返回503
+func NewBuilder(limit int) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limit: limit,
+		priority: func(c *web.Context) Priority {
+			return Normal
+		},
+		routes: map[string]*limiter{},
+	}
+}
+
+// PerRoute 每个路由单独的并发上限
+func (m *MiddlewareBuilder) PerRoute(limit int) *MiddlewareBuilder {
+	m.routeLimit = limit
+	return m
+}
+
+// Queue 超过上限的请求最多排队 size 个，最多等待 timeout
+func (m *MiddlewareBuilder) Queue(size int, timeout time.Duration) *MiddlewareBuilder {
+	m.queueSize = size
+	m.queueTimeout = timeout
+	return m
+}
+
+// Adaptive 根据延迟自动调整全局和每个路由的上限，可以使用 AIMD 或者 Gradient
+func (m *MiddlewareBuilder) Adaptive(adaptive Adaptive) *MiddlewareBuilder {
+	m.adaptive = adaptive
+	return m
+}
+
+func (m *MiddlewareBuilder) Priority(fn func(c *web.Context) Priority) *MiddlewareBuilder {
+	m.priority = fn
+	return m
+}
+
+// InFlight 全局正在处理的请求数，可以通过 prometheus 中间件的 InFlight 导出
+func (m *MiddlewareBuilder) InFlight() int {
+	if m.global == nil {
+		return 0
+	}
+	inFlight, _ := m.global.stats()
+	return inFlight
+}
+
+// Limit 当前的全局并发上限，自适应模式下会变化
+func (m *MiddlewareBuilder) Limit() int {
+	if m.global == nil {
+		return 0
+	}
+	_, limit := m.global.stats()
+	return limit
+}
+
+// Build 只应该调用一次，多次调用会重置全局的计数
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	if m.limit > 0 {
+		m.global = newLimiter(m.limit, m.queueSize, m.adaptive)
+	}
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			priority := m.priority(c)
+			// 先拿路由的名额，在路由的队列里面等待的请求不占用全局名额，不会挡住其它路由
+			limiters := make([]*limiter, 0, 2)
+			if l := m.routeLimiter(c); l != nil {
+				limiters = append(limiters, l)
+			}
+			if m.global != nil {
+				limiters = append(limiters, m.global)
+			}
+
+			for i, l := range limiters {
+				if !l.acquire(c.Request.Context(), priority, m.queueTimeout) {
+					for j := i - 1; j >= 0; j-- {
+						limiters[j].cancel()
+					}
+					// 提前设置响应码，外层的监控和日志中间件才能看到503
+					c.AbortWithStatus(http.StatusServiceUnavailable)
+					c.Error(web.NewHTTPError(http.StatusServiceUnavailable, ""))
+					return
+				}
+			}
+			start := time.Now()
+			defer func() {
+				latency := time.Since(start)
+				for i := len(limiters) - 1; i >= 0; i-- {
+					limiters[i].release(latency)
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) routeLimiter(c *web.Context) *limiter {
+	if m.routeLimit <= 0 || c.MatchedRoute == "" {
+		return nil
+	}
+	key := c.Request.Method + " " + c.MatchedRoute
+	m.routesMu.Lock()
+	defer m.routesMu.Unlock()
+	l, ok := m.routes[key]
+	if !ok {
+		l = newLimiter(m.routeLimit, m.queueSize, m.adaptive)
+		m.routes[key] = l
+	}
+	return l
+}
@@ -0,0 +1,182 @@
+package loadshed
+
+import (
+	"WebFramework/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 阻塞的业务逻辑，release 之后才返回
+type blockingServer struct {
+	s       http.Handler
+	started chan string
+	release chan struct{}
+	// 外层中间件看到的响应码
+	lastStatus chan int
+}
+
+func newBlockingServer(builder *MiddlewareBuilder) *blockingServer {
+	b := &blockingServer{started: make(chan string, 10), release: make(chan struct{}), lastStatus: make(chan int, 10)}
+	observer := func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			next(c)
+			select {
+			case b.lastStatus <- c.RespStatusCode:
+			default:
+			}
+		}
+	}
+	s := web.NewHttpServer(web.WithMiddleware(observer, builder.Build()))
+	b.s = s
+	handler := func(c *web.Context) {
+		b.started <- c.Request.URL.Path
+		<-b.release
+		c.RespStatusCode = http.StatusOK
+	}
+	for _, path := range []string{"/a", "/b", "/low", "/high"} {
+		s.Get(path, handler)
+	}
+	s.Get("/healthz", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+	return b
+}
+
+func (b *blockingServer) serve(path string) chan int {
+	res := make(chan int, 1)
+	go func() {
+		recorder := httptest.NewRecorder()
+		b.s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		res <- recorder.Code
+	}()
+	return res
+}
+
+func TestMiddlewareBuilder_Global(t *testing.T) {
+	builder := NewBuilder(1).Priority(PriorityByRoute(map[string]Priority{"/healthz": Critical}, Normal))
+	b := newBlockingServer(builder)
+
+	first := b.serve("/a")
+	assert.Equal(t, "/a", <-b.started)
+	assert.Equal(t, 1, builder.InFlight())
+	assert.Equal(t, http.StatusServiceUnavailable, <-b.serve("/b"))
+	assert.Equal(t, http.StatusServiceUnavailable, <-b.lastStatus)
+	// 健康检查不受限制
+	assert.Equal(t, http.StatusOK, <-b.serve("/healthz"))
+
+	close(b.release)
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, 0, builder.InFlight())
+}
+
+func TestMiddlewareBuilder_Queue(t *testing.T) {
+	builder := NewBuilder(1).Queue(1, time.Second).Priority(PriorityByRoute(map[string]Priority{
+		"/low":  Low,
+		"/high": High,
+	}, Normal))
+	b := newBlockingServer(builder)
+
+	first := b.serve("/a")
+	assert.Equal(t, "/a", <-b.started)
+	low := b.serve("/low")
+	require.Eventually(t, func() bool {
+		builder.global.mu.Lock()
+		defer builder.global.mu.Unlock()
+		return len(builder.global.queue) == 1
+	}, time.Second, time.Millisecond)
+	// 队列满了，挤掉优先级低的
+	high := b.serve("/high")
+	assert.Equal(t, http.StatusServiceUnavailable, <-low)
+
+	b.release <- struct{}{}
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, "/high", <-b.started)
+	b.release <- struct{}{}
+	assert.Equal(t, http.StatusOK, <-high)
+}
+
+func TestMiddlewareBuilder_QueueTimeout(t *testing.T) {
+	b := newBlockingServer(NewBuilder(1).Queue(1, 10*time.Millisecond))
+	first := b.serve("/a")
+	assert.Equal(t, "/a", <-b.started)
+	assert.Equal(t, http.StatusServiceUnavailable, <-b.serve("/b"))
+	close(b.release)
+	assert.Equal(t, http.StatusOK, <-first)
+}
+
+func TestMiddlewareBuilder_PerRoute(t *testing.T) {
+	b := newBlockingServer(NewBuilder(0).PerRoute(1))
+	first := b.serve("/a")
+	assert.Equal(t, "/a", <-b.started)
+	assert.Equal(t, http.StatusServiceUnavailable, <-b.serve("/a"))
+	// 其它路由不受影响
+	second := b.serve("/b")
+	assert.Equal(t, "/b", <-b.started)
+	close(b.release)
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, http.StatusOK, <-second)
+}
+
+func TestMiddlewareBuilder_PerRouteQueue(t *testing.T) {
+	builder := NewBuilder(2).PerRoute(1).Queue(1, time.Second)
+	b := newBlockingServer(builder)
+	first := b.serve("/a")
+	assert.Equal(t, "/a", <-b.started)
+	queued := b.serve("/a")
+	require.Eventually(t, func() bool {
+		builder.routesMu.Lock()
+		l := builder.routes[http.MethodGet+" /a"]
+		builder.routesMu.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.queue) == 1
+	}, time.Second, time.Millisecond)
+	// 在路由队列里面等待的请求不占用全局名额
+	assert.Equal(t, 1, builder.InFlight())
+	other := b.serve("/b")
+	assert.Equal(t, "/b", <-b.started)
+
+	close(b.release)
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, http.StatusOK, <-other)
+	assert.Equal(t, http.StatusOK, <-queued)
+	assert.Equal(t, 0, builder.InFlight())
+}
+
+func TestAdaptive(t *testing.T) {
+	aimd := AIMD{Threshold: 100 * time.Millisecond}.newController(10)
+	assert.Equal(t, 11, aimd.update(10, 10*time.Millisecond, 5))
+	assert.Equal(t, 10, aimd.update(10, 10*time.Millisecond, 4))
+	assert.Equal(t, 9, aimd.update(10, time.Second, 10))
+	assert.Equal(t, 1, aimd.update(1, time.Second, 1))
+	assert.Equal(t, 100, aimd.update(100, 10*time.Millisecond, 100))
+
+	gradient := Gradient{}.newController(20)
+	limit := 20
+	// 延迟稳定的时候上限增长
+	for i := 0; i < 20; i++ {
+		limit = gradient.update(limit, 10*time.Millisecond, limit)
+	}
+	assert.Greater(t, limit, 20)
+	grown := limit
+	// 延迟升高之后上限下降
+	for i := 0; i < 20; i++ {
+		limit = gradient.update(limit, 100*time.Millisecond, limit)
+	}
+	assert.Less(t, limit, grown)
+	assert.GreaterOrEqual(t, limit, 1)
+}
+
+func TestMiddlewareBuilder_Adaptive(t *testing.T) {
+	builder := NewBuilder(4).Adaptive(AIMD{Threshold: time.Millisecond, Backoff: 0.5})
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
+	s.Get("/slow", func(c *web.Context) {
+		time.Sleep(5 * time.Millisecond)
+	})
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, 2, builder.Limit())
+}
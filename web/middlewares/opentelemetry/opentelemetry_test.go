@@ -2,91 +2,43 @@ package opentelemetry
 
 import (
 	"WebFramework/web"
-	"go.opentelemetry.io/otel"
+	"WebFramework/web/webtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/jaeger"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
-	"log"
-	"os"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
 	"testing"
-	"time"
 )
 
 func TestOpenTeleMetry(t *testing.T) {
-	tracer := otel.GetTracerProvider().Tracer(defaultInstrumentationName)
-	s := web.NewHttpServer(web.WithMiddleware(NewBuilder().Build()))
-	s.Get("/user", func(c *web.Context) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer(defaultInstrumentationName)
+
+	s := web.NewHttpServer(web.WithMiddleware((&MiddlewareBuilder{Tracer: tracer}).Build()))
+	s.Get("/user/:id", func(c *web.Context) {
 		ctx, span := tracer.Start(c.Request.Context(), "first_layer")
 		defer span.End()
 
-		secondC, second := tracer.Start(ctx, "second_layer")
-		time.Sleep(time.Second)
-
-		_, third1 := tracer.Start(secondC, "third_layer_1")
-		time.Sleep(100 * time.Millisecond)
-		third1.End()
-
-		_, third2 := tracer.Start(secondC, "third_layer_2")
-		time.Sleep(300 * time.Millisecond)
-		third2.End()
+		_, second := tracer.Start(ctx, "second_layer")
 		second.End()
-
-		_, first := tracer.Start(c.Request.Context(), "first_layer_1")
-		defer first.End()
-
-		time.Sleep(100 * time.Millisecond)
 		c.JSON(202, User{Name: "qwe"})
 	})
 
-	initZipkin(t)
+	webtest.New(t, s).Get("/user/1").Expect().Status(http.StatusAccepted)
 
-	_ = s.Start(":8080")
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	second, first, root := spans[0], spans[1], spans[2]
+	assert.Equal(t, "/user/:id", root.Name())
+	assert.Contains(t, root.Attributes(), attribute.Int("http.status", 202))
+	assert.Contains(t, root.Attributes(), attribute.String("http.method", http.MethodGet))
+	assert.Equal(t, root.SpanContext().SpanID(), first.Parent().SpanID())
+	assert.Equal(t, first.SpanContext().SpanID(), second.Parent().SpanID())
 }
 
 type User struct {
 	Name string
 }
-
-func initZipkin(t *testing.T) {
-	exporter, err := zipkin.New(
-		"http://localhost:19411/api/v2/spans",
-		zipkin.WithLogger(log.New(os.Stderr, "opentelemetry-demo", log.Ldate|log.Ltime|log.Llongfile)),
-	)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	batcher := sdktrace.NewBatchSpanProcessor(exporter)
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSpanProcessor(batcher),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("opentelemetry-demo"),
-		)),
-	)
-	otel.SetTracerProvider(tp)
-}
-
-func initJeager(t *testing.T) {
-	url := "http://localhost:14268/api/traces"
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(url)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	tp := sdktrace.NewTracerProvider(
-		// Always be sure to batch in production.
-		sdktrace.WithBatcher(exp),
-		// Record information about this application in a Resource.
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("opentelemetry-demo"),
-			attribute.String("environment", "dev"),
-			attribute.Int64("ID", 1),
-		)),
-	)
-
-	otel.SetTracerProvider(tp)
-}
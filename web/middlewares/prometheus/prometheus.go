@@ -10,23 +10,34 @@ import (
 type MiddlewareBuilder struct {
 	namespace   string
 	subsystem   string
+	name        string
 	constLabels map[string]string
 	help        string
+	inFlight    func() int
 }
 
 type Options struct {
-	Namespace   string
-	Subsystem   string
+	Namespace string
+	Subsystem string
+	// Name 请求耗时的指标名，默认是 http_request_duration_milliseconds
+	Name        string
 	ConstLabels map[string]string
 	Help        string
+	// InFlight 设置之后导出 in_flight_requests，可以直接使用 loadshed 中间件的 InFlight
+	InFlight func() int
 }
 
 func NewBuilder(opt Options) *MiddlewareBuilder {
+	if opt.Name == "" {
+		opt.Name = "http_request_duration_milliseconds"
+	}
 	return &MiddlewareBuilder{
 		namespace:   opt.Namespace,
 		subsystem:   opt.Subsystem,
+		name:        opt.Name,
 		constLabels: opt.ConstLabels,
 		help:        opt.Help,
+		inFlight:    opt.InFlight,
 	}
 }
 
@@ -34,6 +45,7 @@ func (m MiddlewareBuilder) Build() web.Middleware {
 	vec := prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   m.namespace,
 		Subsystem:   m.subsystem,
+		Name:        m.name,
 		Help:        m.help,
 		ConstLabels: m.constLabels,
 		Objectives: map[float64]float64{
@@ -43,21 +55,33 @@ func (m MiddlewareBuilder) Build() web.Middleware {
 			0.99:  0.001,
 			0.999: 0.0001,
 		},
-	}, []string{"pattern", "method", "status"})
+	}, []string{"pattern", "method", "status", "version"})
 	prometheus.MustRegister(vec)
+	if m.inFlight != nil {
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   m.namespace,
+			Subsystem:   m.subsystem,
+			Name:        "in_flight_requests",
+			Help:        "Number of requests currently being served",
+			ConstLabels: m.constLabels,
+		}, func() float64 {
+			return float64(m.inFlight())
+		}))
+	}
 
 	return func(next web.HandleFunc) web.HandleFunc {
 		return func(c *web.Context) {
 			start := time.Now()
 			defer func() {
+				duration := time.Now().Sub(start).Milliseconds()
+				pattern := c.MatchedRoute
+				if pattern == "" {
+					pattern = "unknown"
+				}
+				// 在当前goroutine读取 Context，外层处理错误的时候还会修改它
+				labels := []string{pattern, c.Request.Method, strconv.Itoa(c.RespStatusCode), c.APIVersion}
 				go func() {
-					duration := time.Now().Sub(start).Milliseconds()
-					pattern := c.MatchedRoute
-					if pattern == "" {
-						pattern = "unknown"
-					}
-					code := strconv.Itoa(c.RespStatusCode)
-					vec.WithLabelValues(pattern, c.Request.Method, code).Observe(float64(duration))
+					vec.WithLabelValues(labels...).Observe(float64(duration))
 				}()
 			}()
 			next(c)
@@ -2,9 +2,13 @@ package prometheus
 
 import (
 	"WebFramework/web"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"math/rand"
+	"WebFramework/web/middlewares/loadshed"
+	"WebFramework/web/webtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -19,14 +23,66 @@ func TestPrometheus(t *testing.T) {
 	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
 
 	s.Get("/user", func(c *web.Context) {
-		time.Sleep(time.Millisecond * time.Duration(rand.Intn(1000)+1))
 		c.JSON(200, map[string]string{"name": "ppp"})
 	})
 
+	client := webtest.New(t, s)
+	for i := 0; i < 3; i++ {
+		client.Get("/user").Expect().Status(http.StatusOK)
+	}
+
+	// 指标是异步记录的
+	assert.Eventually(t, func() bool {
+		families, err := prometheus.DefaultGatherer.Gather()
+		require.NoError(t, err)
+		for _, f := range families {
+			if f.GetName() != "namespace_test_subsystem_test_http_request_duration_milliseconds" {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				if m.GetSummary().GetSampleCount() == 3 {
+					return true
+				}
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBuilder_InFlight(t *testing.T) {
+	shed := loadshed.NewBuilder(10)
+	builder := NewBuilder(Options{
+		Namespace: "inflight_test",
+		Help:      "help_test",
+		InFlight:  shed.InFlight,
+	})
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build(), shed.Build()))
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Get("/user", func(c *web.Context) {
+		close(started)
+		<-release
+		c.RespStatusCode = http.StatusOK
+	})
+	gauge := func() float64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		require.NoError(t, err)
+		for _, f := range families {
+			if f.GetName() == "inflight_test_in_flight_requests" {
+				return f.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		return -1
+	}
+
+	assert.Equal(t, float64(0), gauge())
+	done := make(chan struct{})
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		_ = http.ListenAndServe(":8081", nil)
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user", nil))
+		close(done)
 	}()
-
-	_ = s.Start(":8080")
+	<-started
+	assert.Equal(t, float64(1), gauge())
+	close(release)
+	<-done
+	assert.Equal(t, float64(0), gauge())
 }
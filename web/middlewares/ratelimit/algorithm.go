@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// State 限流算法保存在 Store 里面的状态，共享的 Store 可以把它序列化之后保存
+type State struct {
+	// Tokens 令牌桶里面剩余的令牌
+	Tokens float64 `json:"tokens,omitempty"`
+	// Count 固定窗口里面的请求数
+	Count int `json:"count,omitempty"`
+	// Start 令牌桶上次补充令牌的时间，或者固定窗口开始的时间
+	Start time.Time `json:"start,omitempty"`
+	// Log 滑动窗口里面每个请求的时间
+	Log []time.Time `json:"log,omitempty"`
+}
+
+// Result 一次检查的结果
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset 多久之后额度完全恢复
+	Reset time.Duration
+	// RetryAfter 被拒绝的时候多久之后可以重试
+	RetryAfter time.Duration
+}
+
+// Algorithm 限流算法
+type Algorithm interface {
+	// Take 根据状态判断这次请求能否通过，并且修改状态
+	Take(state *State, now time.Time) Result
+	// TTL 状态在多久没有访问之后可以清除
+	TTL() time.Duration
+}
+
+// checkLimit 参数不合法的时候在创建的时候 panic，而不是在处理请求的时候出错
+func checkLimit(limit int, window time.Duration) {
+	if limit <= 0 {
+		panic(fmt.Sprintf("ratelimit: limit must be positive, got %d", limit))
+	}
+	if window <= 0 {
+		panic(fmt.Sprintf("ratelimit: window must be positive, got %s", window))
+	}
+}
+
+// TokenBucket 令牌桶，每 per 时间补充 limit 个令牌，最多攒 burst 个
+// 允许突发流量，长期来看速率不超过 limit/per，参数都必须大于0
+func TokenBucket(limit int, per time.Duration, burst int) Algorithm {
+	checkLimit(limit, per)
+	if burst <= 0 {
+		panic(fmt.Sprintf("ratelimit: burst must be positive, got %d", burst))
+	}
+	return tokenBucket{rate: float64(limit) / per.Seconds(), burst: burst}
+}
+
+type tokenBucket struct {
+	// 每秒补充的令牌
+	rate  float64
+	burst int
+}
+
+func (t tokenBucket) Take(state *State, now time.Time) Result {
+	if state.Start.IsZero() {
+		state.Tokens = float64(t.burst)
+	} else if elapsed := now.Sub(state.Start).Seconds(); elapsed > 0 {
+		state.Tokens = math.Min(float64(t.burst), state.Tokens+elapsed*t.rate)
+	}
+	state.Start = now
+
+	res := Result{Limit: t.burst}
+	if state.Tokens >= 1 {
+		state.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = t.duration(1 - state.Tokens)
+	}
+	res.Remaining = int(state.Tokens)
+	res.Reset = t.duration(float64(t.burst) - state.Tokens)
+	return res
+}
+
+// duration 补充 tokens 个令牌需要的时间
+func (t tokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / t.rate * float64(time.Second))
+}
+
+func (t tokenBucket) TTL() time.Duration {
+	return t.duration(float64(t.burst))
+}
+
+// FixedWindow 固定窗口，每个 window 最多 limit 个请求，窗口按照 window 对齐
+// 实现简单，但是窗口边界上可能通过两倍的请求，参数都必须大于0
+func FixedWindow(limit int, window time.Duration) Algorithm {
+	checkLimit(limit, window)
+	return fixedWindow{limit: limit, window: window}
+}
+
+type fixedWindow struct {
+	limit  int
+	window time.Duration
+}
+
+func (f fixedWindow) Take(state *State, now time.Time) Result {
+	start := now.Truncate(f.window)
+	if !state.Start.Equal(start) {
+		state.Start = start
+		state.Count = 0
+	}
+	res := Result{Limit: f.limit, Reset: start.Add(f.window).Sub(now)}
+	if state.Count < f.limit {
+		state.Count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = res.Reset
+	}
+	res.Remaining = f.limit - state.Count
+	return res
+}
+
+func (f fixedWindow) TTL() time.Duration {
+	return f.window
+}
+
+// SlidingLog 滑动窗口日志，任意 window 时间内最多 limit 个请求
+// 最精确，但是每个key要保存 limit 个时间，参数都必须大于0
+func SlidingLog(limit int, window time.Duration) Algorithm {
+	checkLimit(limit, window)
+	return slidingLog{limit: limit, window: window}
+}
+
+type slidingLog struct {
+	limit  int
+	window time.Duration
+}
+
+func (s slidingLog) Take(state *State, now time.Time) Result {
+	boundary := now.Add(-s.window)
+	i := 0
+	for i < len(state.Log) && !state.Log[i].After(boundary) {
+		i++
+	}
+	state.Log = state.Log[i:]
+
+	res := Result{Limit: s.limit}
+	if len(state.Log) < s.limit {
+		state.Log = append(state.Log, now)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = state.Log[0].Add(s.window).Sub(now)
+	}
+	res.Remaining = s.limit - len(state.Log)
+	res.Reset = state.Log[len(state.Log)-1].Add(s.window).Sub(now)
+	return res
+}
+
+func (s slidingLog) TTL() time.Duration {
+	return s.window
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"WebFramework/web"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc 返回限流的key，返回空字符串表示这个请求不限流
+type KeyFunc func(c *web.Context) string
+
+// ByIP 按照客户端IP限流，使用的是 RemoteAddr，前面有代理的时候使用 ByHeader("X-Real-IP")
+func ByIP() KeyFunc {
+	return func(c *web.Context) string {
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			return c.Request.RemoteAddr
+		}
+		return host
+	}
+}
+
+// ByHeader 按照请求头限流，例如 API key
+func ByHeader(name string) KeyFunc {
+	return func(c *web.Context) string {
+		return c.Request.Header.Get(name)
+	}
+}
+
+// ByValue 按照 Context 存储的数据限流，例如认证中间件写入的用户ID，没有的时候不限流
+func ByValue(key string) KeyFunc {
+	return func(c *web.Context) string {
+		val, ok := c.Get(key)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprint(val)
+	}
+}
+
+// ByRoute 按照匹配到的路由限流，也就是所有客户端共享同一个路由的额度，没有匹配到路由的请求不限流
+// server 会在执行中间件之前匹配路由，所以注册成server级别的中间件也可以使用
+func ByRoute() KeyFunc {
+	return func(c *web.Context) string {
+		if c.MatchedRoute == "" {
+			return ""
+		}
+		return c.Request.Method + " " + c.MatchedRoute
+	}
+}
+
+// Keys 组合多个key，例如每个用户在每个路由上单独限流，任何一个为空都不限流
+func Keys(fns ...KeyFunc) KeyFunc {
+	return func(c *web.Context) string {
+		res := ""
+		for i, fn := range fns {
+			key := fn(c)
+			if key == "" {
+				return ""
+			}
+			if i > 0 {
+				res += "|"
+			}
+			res += key
+		}
+		return res
+	}
+}
+
+type MiddlewareBuilder struct {
+	algorithm Algorithm
+	keyFunc   KeyFunc
+	store     Store
+	prefix    string
+	now       func() time.Time
+	log       func(msg string, args ...any)
+}
+
+// NewBuilder 默认按照IP限流，使用最多保存10000个key的 MemoryStore
+// 分组或者路由单独的额度通过 Group.Use 或者 UseWithRoute 注册不同的中间件
+func NewBuilder(algorithm Algorithm) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		algorithm: algorithm,
+		keyFunc:   ByIP(),
+		store:     NewMemoryStore(10000),
+		now:       time.Now,
+		log: func(msg string, args ...any) {
+			fmt.Printf(msg, args...)
+		},
+	}
+}
+
+func (m *MiddlewareBuilder) Key(fn KeyFunc) *MiddlewareBuilder {
+	m.keyFunc = fn
+	return m
+}
+
+// Store 多个中间件共享同一个 Store 的时候需要通过 Prefix 区分
+func (m *MiddlewareBuilder) Store(store Store) *MiddlewareBuilder {
+	m.store = store
+	return m
+}
+
+// Prefix key的前缀
+func (m *MiddlewareBuilder) Prefix(prefix string) *MiddlewareBuilder {
+	m.prefix = prefix
+	return m
+}
+
+func (m *MiddlewareBuilder) LogFunc(log func(msg string, args ...any)) *MiddlewareBuilder {
+	m.log = log
+	return m
+}
+
+// Build 超过限制的请求返回429，所有响应都带上 RateLimit-Limit、RateLimit-Remaining 和 RateLimit-Reset
+// Store 出错的时候放行请求
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			key := m.keyFunc(c)
+			if key == "" {
+				next(c)
+				return
+			}
+			var res Result
+			err := m.store.Update(c.Request.Context(), m.prefix+key, m.algorithm.TTL(), func(state *State) {
+				res = m.algorithm.Take(state, m.now())
+			})
+			if err != nil {
+				m.log("ratelimit: store error: %v\n", err)
+				next(c)
+				return
+			}
+
+			header := c.Writer.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				header.Set("Retry-After", seconds(res.RetryAfter))
+				// 错误在最后才会变成响应码，提前设置好，外层的监控和日志中间件才能看到429
+				c.AbortWithStatus(http.StatusTooManyRequests)
+				c.Error(web.NewHTTPError(http.StatusTooManyRequests, ""))
+				return
+			}
+			next(c)
+		}
+	}
+}
+
+// seconds 向上取整的秒数
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,230 @@
+package ratelimit
+
+import (
+	"WebFramework/web"
+	"WebFramework/web/middlewares/prometheus"
+	"WebFramework/web/webtest"
+	"context"
+	"errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlgorithms(t *testing.T) {
+	start := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	// 每个步骤距离开始的时间和期望的结果
+	type step struct {
+		at      time.Duration
+		allowed bool
+		remain  int
+		retry   time.Duration
+	}
+	testCases := []struct {
+		name      string
+		algorithm Algorithm
+		steps     []step
+	}{
+		{
+			name:      "token bucket",
+			algorithm: TokenBucket(1, time.Second, 2),
+			steps: []step{
+				{at: 0, allowed: true, remain: 1},
+				{at: 0, allowed: true, remain: 0},
+				{at: 0, allowed: false, remain: 0, retry: time.Second},
+				{at: 500 * time.Millisecond, allowed: false, remain: 0, retry: 500 * time.Millisecond},
+				{at: time.Second, allowed: true, remain: 0},
+				{at: 10 * time.Second, allowed: true, remain: 1},
+			},
+		},
+		{
+			name:      "fixed window",
+			algorithm: FixedWindow(2, time.Minute),
+			steps: []step{
+				{at: 0, allowed: true, remain: 1},
+				{at: 10 * time.Second, allowed: true, remain: 0},
+				{at: 20 * time.Second, allowed: false, remain: 0, retry: 40 * time.Second},
+				{at: time.Minute, allowed: true, remain: 1},
+			},
+		},
+		{
+			name:      "sliding log",
+			algorithm: SlidingLog(2, time.Minute),
+			steps: []step{
+				{at: 0, allowed: true, remain: 1},
+				{at: 30 * time.Second, allowed: true, remain: 0},
+				{at: 50 * time.Second, allowed: false, remain: 0, retry: 10 * time.Second},
+				{at: time.Minute + time.Second, allowed: true, remain: 0},
+				{at: 90 * time.Second, allowed: true, remain: 0},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &State{}
+			for i, s := range tc.steps {
+				res := tc.algorithm.Take(state, start.Add(s.at))
+				assert.Equal(t, s.allowed, res.Allowed, "step %d", i)
+				assert.Equal(t, s.remain, res.Remaining, "step %d", i)
+				assert.Equal(t, s.retry, res.RetryAfter, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestAlgorithms_Invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		newAlgo func() Algorithm
+	}{
+		{name: "token bucket zero limit", newAlgo: func() Algorithm { return TokenBucket(0, time.Second, 1) }},
+		{name: "token bucket zero per", newAlgo: func() Algorithm { return TokenBucket(1, 0, 1) }},
+		{name: "token bucket zero burst", newAlgo: func() Algorithm { return TokenBucket(1, time.Second, 0) }},
+		{name: "fixed window negative limit", newAlgo: func() Algorithm { return FixedWindow(-1, time.Second) }},
+		{name: "fixed window zero window", newAlgo: func() Algorithm { return FixedWindow(1, 0) }},
+		{name: "sliding log zero limit", newAlgo: func() Algorithm { return SlidingLog(0, time.Second) }},
+		{name: "sliding log negative window", newAlgo: func() Algorithm { return SlidingLog(1, -time.Second) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Panics(t, func() { tc.newAlgo() })
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore(2)
+	store.now = func() time.Time { return now }
+	incr := func(key string) int {
+		var count int
+		require.NoError(t, store.Update(context.Background(), key, time.Minute, func(state *State) {
+			state.Count++
+			count = state.Count
+		}))
+		return count
+	}
+	assert.Equal(t, 1, incr("a"))
+	assert.Equal(t, 1, incr("b"))
+	assert.Equal(t, 2, incr("a"))
+	// 超过容量，清除最久没有访问的b
+	assert.Equal(t, 1, incr("c"))
+	assert.Equal(t, 2, store.Len())
+	assert.Equal(t, 1, incr("b"))
+
+	// 过期之后清除
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 1, incr("a"))
+	assert.Equal(t, 1, store.Len())
+}
+
+type errStore struct{}
+
+func (errStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error {
+	return errors.New("store down")
+}
+
+func TestMiddlewareBuilder(t *testing.T) {
+	// 固定时间，避免跨过窗口边界
+	now := time.Now().Truncate(time.Hour)
+	newBuilder := func(algorithm Algorithm) *MiddlewareBuilder {
+		b := NewBuilder(algorithm)
+		b.now = func() time.Time { return now }
+		return b
+	}
+	s := web.NewHttpServer()
+	api := s.Group("/api", newBuilder(FixedWindow(2, time.Hour)).Key(ByHeader("X-API-Key")).Build())
+	api.Get("/user", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+	// 每个路由单独的额度
+	s.Get("/search", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+	s.UseWithRoute(http.MethodGet, "/search", newBuilder(FixedWindow(1, time.Hour)).Key(ByRoute()).Build())
+	s.Get("/open", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+	s.UseWithRoute(http.MethodGet, "/open", NewBuilder(FixedWindow(1, time.Hour)).Store(errStore{}).LogFunc(func(string, ...any) {}).Build())
+
+	serve := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("/api/user", "k1")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, recorder.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, http.StatusOK, serve("/api/user", "k1").Code)
+
+	recorder = serve("/api/user", "k1")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	// 其它key不受影响，没有key的请求不限流
+	assert.Equal(t, http.StatusOK, serve("/api/user", "k2").Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve("/api/user", "").Code)
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/search", "k1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/search", "k2").Code)
+
+	// Store 出错的时候放行
+	assert.Equal(t, http.StatusOK, serve("/open", "").Code)
+	assert.Equal(t, http.StatusOK, serve("/open", "").Code)
+}
+
+func TestMiddlewareBuilder_OuterObserver(t *testing.T) {
+	s := web.NewHttpServer(web.WithMiddleware(
+		prometheus.NewBuilder(prometheus.Options{Namespace: "ratelimit_test", Help: "help_test"}).Build(),
+		NewBuilder(FixedWindow(1, time.Hour)).Key(ByRoute()).Build(),
+	))
+	s.Get("/user", func(c *web.Context) {
+		c.RespStatusCode = http.StatusOK
+	})
+	client := webtest.New(t, s)
+	client.Get("/user").Expect().Status(http.StatusOK)
+	client.Get("/user").Expect().Status(http.StatusTooManyRequests)
+
+	// 外层的 prometheus 记录的是429而不是0
+	assert.Eventually(t, func() bool {
+		families, err := prom.DefaultGatherer.Gather()
+		require.NoError(t, err)
+		for _, f := range families {
+			if f.GetName() != "ratelimit_test_http_request_duration_milliseconds" {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				for _, label := range m.GetLabel() {
+					if label.GetName() == "status" && label.GetValue() == "429" {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestKeys(t *testing.T) {
+	c := &web.Context{Request: httptest.NewRequest(http.MethodGet, "/user/1", nil), MatchedRoute: "/user/:id"}
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Set("user", 42)
+	assert.Equal(t, "10.0.0.1", ByIP()(c))
+	assert.Equal(t, "42", ByValue("user")(c))
+	assert.Equal(t, "", ByValue("tenant")(c))
+	assert.Equal(t, "42|GET /user/:id", Keys(ByValue("user"), ByRoute())(c))
+	assert.Equal(t, "", Keys(ByValue("tenant"), ByRoute())(c))
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store 保存每个key的限流状态，多个实例共享限流的时候可以基于redis之类的实现
+type Store interface {
+	// Update 同一个key上的 fn 必须串行执行，fn 修改之后的状态在 ttl 之后没有访问可以被清除
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error
+}
+
+// MemoryStore 单机的 Store，最久没有访问的key在过期或者超过容量之后被清除
+type MemoryStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	items   map[string]*list.Element
+	// 按照访问时间排序，最近访问的在前面
+	lru *list.List
+	now func() time.Time
+}
+
+type memoryItem struct {
+	key      string
+	state    State
+	expireAt time.Time
+}
+
+// NewMemoryStore maxKeys 为0表示不限制key的数量
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	return &MemoryStore{
+		maxKeys: maxKeys,
+		items:   map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.evict(now)
+
+	elem, ok := m.items[key]
+	if ok && !elem.Value.(*memoryItem).expireAt.After(now) {
+		m.remove(elem)
+		ok = false
+	}
+	if !ok {
+		elem = m.lru.PushFront(&memoryItem{key: key})
+		m.items[key] = elem
+	} else {
+		m.lru.MoveToFront(elem)
+	}
+	item := elem.Value.(*memoryItem)
+	fn(&item.state)
+	item.expireAt = now.Add(ttl)
+
+	if m.maxKeys > 0 && m.lru.Len() > m.maxKeys {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+// Len 保存的key的数量
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// evict 从最久没有访问的开始清除过期的key
+func (m *MemoryStore) evict(now time.Time) {
+	for elem := m.lru.Back(); elem != nil; elem = m.lru.Back() {
+		if elem.Value.(*memoryItem).expireAt.After(now) {
+			return
+		}
+		m.remove(elem)
+	}
+}
+
+func (m *MemoryStore) remove(elem *list.Element) {
+	m.lru.Remove(elem)
+	delete(m.items, elem.Value.(*memoryItem).key)
+}
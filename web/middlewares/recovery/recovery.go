@@ -1,6 +1,9 @@
 package recovery
 
-import "WebFramework/web"
+import (
+	"WebFramework/web"
+	"net/http"
+)
 
 type MiddlewareBuilder struct {
 	statusCode int
@@ -27,6 +30,10 @@ func (m *MiddlewareBuilder) Build() web.Middleware {
 		return func(c *web.Context) {
 			defer func() {
 				if err := recover(); err != nil {
+					// 响应已经开始写了，需要中断连接，例如反向代理转发到一半上游断开，交给 net/http 处理
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
 					c.RespData = m.data
 					c.RespStatusCode = m.statusCode
 					m.log(c)
@@ -2,20 +2,47 @@ package recovery
 
 import (
 	"WebFramework/web"
+	"WebFramework/web/webtest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestMiddlewareBuilder_Build(t *testing.T) {
+	logged := false
 	builder := NewBuilder(Options{
 		StatusCode: 500,
 		Data:       []byte("你panic了"),
 		Log: func(c *web.Context) {
-
+			logged = true
 		},
 	})
 	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
 	s.Get("/user", func(c *web.Context) {
 		panic("panic")
 	})
-	_ = s.Start(":8080")
+
+	webtest.New(t, s).Get("/user").Expect().Status(http.StatusInternalServerError).Body("你panic了")
+	assert.True(t, logged)
+}
+
+func TestMiddlewareBuilder_ErrAbortHandler(t *testing.T) {
+	logged := false
+	builder := NewBuilder(Options{
+		StatusCode: 500,
+		Data:       []byte("你panic了"),
+		Log: func(c *web.Context) {
+			logged = true
+		},
+	})
+	s := web.NewHttpServer(web.WithMiddleware(builder.Build()))
+	s.Get("/user", func(c *web.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user", nil))
+	})
+	assert.False(t, logged)
 }
@@ -0,0 +1,146 @@
+package timeout
+
+import (
+	"WebFramework/web"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+type MiddlewareBuilder struct {
+	timeout     time.Duration
+	statusCode  int
+	contentType string
+	data        []byte
+}
+
+// NewBuilder 超过 timeout 之后返回503，可以注册成路由中间件或者分组中间件
+// 业务逻辑在复制出来的 Context 上执行，超时之后写的响应会被丢弃，业务逻辑应该检查 c.Request.Context()
+// 不支持业务逻辑直接 Flush 流式响应，timeout 必须大于0
+func NewBuilder(timeout time.Duration) *MiddlewareBuilder {
+	if timeout <= 0 {
+		panic(fmt.Sprintf("timeout: timeout must be positive, got %s", timeout))
+	}
+	return &MiddlewareBuilder{
+		timeout:     timeout,
+		statusCode:  http.StatusServiceUnavailable,
+		contentType: "text/plain; charset=utf-8",
+		data:        []byte(http.StatusText(http.StatusServiceUnavailable)),
+	}
+}
+
+// StatusCode 超时的时候返回的响应码，一般是503或者504
+func (m *MiddlewareBuilder) StatusCode(code int) *MiddlewareBuilder {
+	m.statusCode = code
+	return m
+}
+
+// Data 超时的时候返回的响应
+func (m *MiddlewareBuilder) Data(contentType string, data []byte) *MiddlewareBuilder {
+	m.contentType = contentType
+	m.data = data
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), m.timeout)
+			defer cancel()
+
+			w := &bufferedWriter{header: http.Header{}}
+			clone := c.Clone(w, c.Request.WithContext(ctx))
+			done := make(chan struct{})
+			panicCh := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p == http.ErrAbortHandler {
+						panicCh <- p
+					} else if p != nil {
+						panicCh <- &PanicError{Value: p, Stack: debug.Stack()}
+					}
+				}()
+				next(clone)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				merge(c, clone)
+				w.copyTo(c)
+			case p := <-panicCh:
+				// 交给外面的 recovery 处理，带上业务逻辑所在goroutine的调用栈
+				panic(p)
+			case <-ctx.Done():
+				// 客户端断开的时候没必要再写响应，这里统一按照超时处理
+				c.Writer.Header().Set("Content-Type", m.contentType)
+				c.RespStatusCode = m.statusCode
+				c.RespData = m.data
+			}
+		}
+	}
+}
+
+// merge 把业务逻辑在 clone 上设置的响应、存储的数据、错误和中断状态复制回来
+func merge(c, clone *web.Context) {
+	c.RespData = clone.RespData
+	c.RespStatusCode = clone.RespStatusCode
+	for k, v := range clone.Keys() {
+		c.Set(k, v)
+	}
+	if clone.Err() != nil {
+		c.CopyErr(clone)
+	}
+	if clone.IsAborted() {
+		c.Abort()
+	}
+}
+
+// PanicError 业务逻辑在另外的goroutine里面panic之后重新抛出的值
+// Stack 是原来panic的地方的调用栈，recover 拿到的调用栈只到这个中间件
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v\n%s", p.Value, p.Stack)
+}
+
+// bufferedWriter 业务逻辑直接写 Writer 的时候先缓存起来，没有超时才复制到真正的 Writer
+type bufferedWriter struct {
+	header http.Header
+	buf    bytes.Buffer
+	code   int
+}
+
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// copyTo 复制响应头，直接写的响应体放在 RespData 前面
+func (w *bufferedWriter) copyTo(c *web.Context) {
+	dst := c.Writer.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	if w.code != 0 && c.RespStatusCode == 0 {
+		c.RespStatusCode = w.code
+	}
+	if w.buf.Len() > 0 {
+		c.RespData = append(w.buf.Bytes(), c.RespData...)
+	}
+}
@@ -0,0 +1,144 @@
+package timeout
+
+import (
+	"WebFramework/web"
+	"WebFramework/web/middlewares/recovery"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	late := make(chan struct{})
+	s := web.NewHttpServer(web.WithMiddleware(recovery.NewBuilder(recovery.Options{
+		StatusCode: http.StatusInternalServerError,
+		Data:       []byte("panic"),
+		Log:        func(c *web.Context) {},
+	}).Build()))
+	api := s.Group("/api", NewBuilder(50*time.Millisecond).Build())
+	api.Get("/fast", func(c *web.Context) {
+		c.Set("user", "tom")
+		c.Writer.Header().Set("X-Handler", "fast")
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte("fast")
+	})
+	api.Get("/write", func(c *web.Context) {
+		c.Writer.WriteHeader(http.StatusCreated)
+		_, _ = c.Writer.Write([]byte("direct"))
+	})
+	api.Get("/slow", func(c *web.Context) {
+		<-c.Request.Context().Done()
+		// 超时之后写的响应会被丢弃
+		c.Writer.Header().Set("X-Handler", "slow")
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte("late")
+		close(late)
+	})
+	api.Get("/error", func(c *web.Context) {
+		c.Error(web.NewHTTPError(http.StatusTeapot, "teapot"))
+	})
+	api.Get("/panic", func(c *web.Context) {
+		panic("boom")
+	})
+	s.Get("/gateway", func(c *web.Context) {
+		time.Sleep(100 * time.Millisecond)
+	})
+	s.UseWithRoute(http.MethodGet, "/gateway",
+		NewBuilder(10*time.Millisecond).StatusCode(http.StatusGatewayTimeout).Data("application/json", []byte(`{"code":504}`)).Build())
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantCode   int
+		wantBody   string
+		wantHeader string
+	}{
+		{name: "fast", path: "/api/fast", wantCode: 200, wantBody: "fast", wantHeader: "fast"},
+		{name: "direct write", path: "/api/write", wantCode: 201, wantBody: "direct"},
+		{name: "slow", path: "/api/slow", wantCode: 503, wantBody: "Service Unavailable"},
+		{name: "error", path: "/api/error", wantCode: 418, wantBody: "teapot"},
+		{name: "panic", path: "/api/panic", wantCode: 500, wantBody: "panic"},
+		{name: "gateway", path: "/gateway", wantCode: 504, wantBody: `{"code":504}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantHeader, recorder.Header().Get("X-Handler"))
+		})
+	}
+	<-late
+}
+
+func TestMiddlewareBuilder_Merge(t *testing.T) {
+	s := web.NewHttpServer(web.WithMiddleware(func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			c.Set("trace", "t1")
+			next(c)
+			user, _ := web.Value[string](c, "user")
+			c.RespData = append(c.RespData, []byte(" "+user)...)
+		}
+	}, NewBuilder(time.Second).Build()))
+	s.Get("/user", func(c *web.Context) {
+		trace, _ := web.Value[string](c, "trace")
+		c.Set("user", "tom")
+		c.RespData = []byte(trace)
+		c.AbortWithStatus(http.StatusAccepted)
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "t1 tom", recorder.Body.String())
+}
+
+func TestNewBuilder_Invalid(t *testing.T) {
+	assert.Panics(t, func() { NewBuilder(0) })
+	assert.Panics(t, func() { NewBuilder(-time.Second) })
+}
+
+func TestMiddlewareBuilder_ErrorHandledOnce(t *testing.T) {
+	var handled int
+	s := web.NewHttpServer(
+		web.WithErrorHandler(func(c *web.Context, err error) {
+			handled++
+			c.RespStatusCode = http.StatusTeapot
+		}),
+		web.WithMiddleware(NewBuilder(time.Second).Build()),
+	)
+	s.Get("/error", func(c *web.Context) {
+		c.Error(errors.New("teapot"))
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/error", nil))
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+	assert.Equal(t, 1, handled)
+}
+
+func TestMiddlewareBuilder_PanicStack(t *testing.T) {
+	var recovered any
+	s := web.NewHttpServer(web.WithMiddleware(func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			defer func() {
+				recovered = recover()
+			}()
+			next(c)
+		}
+	}, NewBuilder(time.Second).Build()))
+	s.Get("/panic", panicHandler)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	pe, ok := recovered.(*PanicError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "boom", pe.Value)
+	assert.Contains(t, string(pe.Stack), "panicHandler")
+}
+
+func panicHandler(c *web.Context) {
+	panic("boom")
+}
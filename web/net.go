@@ -0,0 +1,227 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Step Net 里面的一个步骤
+type Step struct {
+	Name string
+	// Deps 依赖的步骤，依赖的步骤都成功之后才会执行，没有依赖关系的步骤并发执行
+	Deps []string
+	// Timeout 单个步骤的超时时间，0表示不限制
+	Timeout time.Duration
+	// Run 返回的结果不为nil的时候，以 Name 为key写到 Context 的存储里面，后面的步骤可以通过 Value 读取
+	// 步骤是并发执行的，不要在里面写响应，需要中断并返回响应的时候用 AbortStep
+	Run func(ctx context.Context, c *Context) (any, error)
+}
+
+// Net 由步骤组成的有向无环图
+// 第一个出错或者中断了 Context 的步骤会通过 ctx 取消其它还在执行的步骤
+type Net struct {
+	steps []Step
+}
+
+// NewNet 检查步骤的名字不重复、依赖存在并且没有环
+func NewNet(steps ...Step) (*Net, error) {
+	index := make(map[string]Step, len(steps))
+	for _, step := range steps {
+		if step.Name == "" {
+			return nil, errors.New("web: step name cannot be empty")
+		}
+		if step.Run == nil {
+			return nil, fmt.Errorf("web: step '%s' has no run func", step.Name)
+		}
+		if _, ok := index[step.Name]; ok {
+			return nil, fmt.Errorf("web: duplicate step '%s'", step.Name)
+		}
+		index[step.Name] = step
+	}
+	for _, step := range steps {
+		for _, dep := range step.Deps {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("web: step '%s' depends on unknown step '%s'", step.Name, dep)
+			}
+		}
+	}
+
+	// 深度优先检查环，0 未访问，1 访问中，2 已访问
+	state := make(map[string]int, len(steps))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("web: cycle detected at step '%s'", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range index[name].Deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, step := range steps {
+		if err := visit(step.Name); err != nil {
+			return nil, err
+		}
+	}
+	return &Net{steps: steps}, nil
+}
+
+type netAbortKey struct{}
+
+// netAbort 记录第一个调用 AbortStep 的步骤设置的响应，等所有步骤结束之后再写到 Context
+type netAbort struct {
+	mu     sync.Mutex
+	set    bool
+	status int
+	body   any
+	cancel context.CancelFunc
+	c      *Context
+}
+
+// AbortStep 在步骤里面中断 Context 并设置响应，v 不为nil的时候按JSON返回
+// 只有第一次调用生效，其它还在执行的步骤会被取消。ctx 必须是传给 Step.Run 的 ctx
+func AbortStep(ctx context.Context, status int, v any) {
+	a, ok := ctx.Value(netAbortKey{}).(*netAbort)
+	if !ok {
+		panic("web: AbortStep must be called with the ctx passed to Step.Run")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.set {
+		return
+	}
+	a.set, a.status, a.body = true, status, v
+	a.c.Abort()
+	a.cancel()
+}
+
+// MustNewNet 创建失败的时候panic
+func MustNewNet(steps ...Step) *Net {
+	n, err := NewNet(steps...)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Run 执行所有步骤，返回第一个错误
+// 超时的错误会转换成504的 HTTPError，请求本身被取消的时候返回 ctx.Err()，例如客户端断开
+func (n *Net) Run(c *Context) error {
+	parent := c.Request.Context()
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	abort := &netAbort{cancel: cancel, c: c}
+	ctx = context.WithValue(ctx, netAbortKey{}, abort)
+
+	done := make(map[string]chan struct{}, len(n.steps))
+	for _, step := range n.steps {
+		done[step.Name] = make(chan struct{})
+	}
+
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	wg := sync.WaitGroup{}
+	for _, step := range n.steps {
+		wg.Add(1)
+		go func(step Step) {
+			defer wg.Done()
+			defer close(done[step.Name])
+			for _, dep := range step.Deps {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// 依赖的步骤失败了
+			if ctx.Err() != nil {
+				return
+			}
+			if err := n.runStep(ctx, c, step); err != nil {
+				// 被其它步骤取消导致的错误不算
+				if !(ctx.Err() != nil && errors.Is(err, context.Canceled)) {
+					fail(err)
+				}
+				return
+			}
+			if c.IsAborted() {
+				cancel()
+			}
+		}(step)
+	}
+	wg.Wait()
+	// 所有步骤都结束了，在调用方的goroutine里写响应
+	if abort.set {
+		if abort.body != nil {
+			c.JSON(abort.status, abort.body)
+		} else {
+			c.RespStatusCode = abort.status
+		}
+	}
+	// 步骤因为请求被取消提前返回，没有记录错误，不能当作全部成功了
+	if firstErr == nil && parent.Err() != nil {
+		return parent.Err()
+	}
+	return firstErr
+}
+
+func (n *Net) runStep(ctx context.Context, c *Context, step Step) (err error) {
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("web: step '%s' panic: %v", step.Name, r)
+		}
+	}()
+
+	res, err := step.Run(ctx, c)
+	if err == nil && ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return NewHTTPError(http.StatusGatewayTimeout, "").Wrap(fmt.Errorf("web: step '%s': %w", step.Name, err))
+		}
+		return fmt.Errorf("web: step '%s': %w", step.Name, err)
+	}
+	if res != nil {
+		c.Set(step.Name, res)
+	}
+	return nil
+}
+
+// Build 转换成 HandleFunc，所有步骤成功之后执行 then 组装响应
+// 出错的时候交给server的 ErrorHandler 处理，被中断的时候不执行 then
+func (n *Net) Build(then HandleFunc) HandleFunc {
+	return func(c *Context) {
+		if err := n.Run(c); err != nil {
+			c.Error(err)
+			return
+		}
+		if c.IsAborted() {
+			return
+		}
+		then(c)
+	}
+}
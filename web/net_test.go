@@ -0,0 +1,178 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewNet(t *testing.T) {
+	run := func(ctx context.Context, c *Context) (any, error) { return nil, nil }
+	testcase := []struct {
+		name    string
+		steps   []Step
+		wantErr error
+	}{
+		{name: "ok", steps: []Step{{Name: "a", Run: run}, {Name: "b", Deps: []string{"a"}, Run: run}}},
+		{name: "empty name", steps: []Step{{Run: run}}, wantErr: errors.New("web: step name cannot be empty")},
+		{name: "no run", steps: []Step{{Name: "a"}}, wantErr: errors.New("web: step 'a' has no run func")},
+		{name: "duplicate", steps: []Step{{Name: "a", Run: run}, {Name: "a", Run: run}}, wantErr: errors.New("web: duplicate step 'a'")},
+		{name: "unknown dep", steps: []Step{{Name: "a", Deps: []string{"b"}, Run: run}}, wantErr: errors.New("web: step 'a' depends on unknown step 'b'")},
+		{
+			name:    "cycle",
+			steps:   []Step{{Name: "a", Deps: []string{"b"}, Run: run}, {Name: "b", Deps: []string{"a"}, Run: run}},
+			wantErr: errors.New("web: cycle detected at step 'a'"),
+		},
+	}
+	for _, tt := range testcase {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewNet(tt.steps...)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestNet_Run(t *testing.T) {
+	sleep := func(d time.Duration, res any) func(ctx context.Context, c *Context) (any, error) {
+		return func(ctx context.Context, c *Context) (any, error) {
+			select {
+			case <-time.After(d):
+				return res, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		n := MustNewNet(
+			Step{Name: "user", Run: sleep(100*time.Millisecond, "ppp")},
+			Step{Name: "order", Run: sleep(100*time.Millisecond, 3)},
+			Step{Name: "summary", Deps: []string{"user", "order"}, Run: func(ctx context.Context, c *Context) (any, error) {
+				user, _ := Value[string](c, "user")
+				order, _ := Value[int](c, "order")
+				return map[string]any{"user": user, "order": order}, nil
+			}},
+		)
+		s := NewHttpServer()
+		s.Get("/summary", n.Build(func(c *Context) {
+			c.JSON(http.StatusOK, c.MustGet("summary"))
+		}))
+
+		start := time.Now()
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/summary", nil))
+		// user 和 order 并发执行
+		assert.Less(t, time.Since(start), 190*time.Millisecond)
+		assert.Equal(t, `{"order":3,"user":"ppp"}`, recorder.Body.String())
+	})
+
+	t.Run("error cancels siblings", func(t *testing.T) {
+		var cancelled int32
+		n := MustNewNet(
+			Step{Name: "slow", Run: func(ctx context.Context, c *Context) (any, error) {
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					atomic.StoreInt32(&cancelled, 1)
+				}
+				return nil, ctx.Err()
+			}},
+			Step{Name: "fail", Run: func(ctx context.Context, c *Context) (any, error) {
+				time.Sleep(20 * time.Millisecond)
+				return nil, NewHTTPError(http.StatusBadGateway, "backend down")
+			}},
+			Step{Name: "after", Deps: []string{"fail"}, Run: func(ctx context.Context, c *Context) (any, error) {
+				t.Error("should not run")
+				return nil, nil
+			}},
+		)
+		c := &Context{Request: httptest.NewRequest(http.MethodGet, "/", nil)}
+		err := n.Run(c)
+		var httpErr *HTTPError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusBadGateway, httpErr.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&cancelled))
+	})
+
+	t.Run("abort cancels siblings", func(t *testing.T) {
+		n := MustNewNet(
+			Step{Name: "slow", Run: sleep(time.Second, nil)},
+			Step{Name: "auth", Run: func(ctx context.Context, c *Context) (any, error) {
+				c.Abort()
+				return nil, nil
+			}},
+		)
+		s := NewHttpServer()
+		s.Get("/", n.Build(func(c *Context) {
+			t.Error("should not run")
+		}))
+		start := time.Now()
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("abort step with response", func(t *testing.T) {
+		deny := func(code string) func(ctx context.Context, c *Context) (any, error) {
+			return func(ctx context.Context, c *Context) (any, error) {
+				AbortStep(ctx, http.StatusForbidden, map[string]string{"code": code})
+				return nil, nil
+			}
+		}
+		n := MustNewNet(
+			Step{Name: "slow", Run: sleep(time.Second, nil)},
+			Step{Name: "a", Run: deny("a")},
+			Step{Name: "b", Run: deny("b")},
+		)
+		s := NewHttpServer()
+		s.Get("/", n.Build(func(c *Context) {
+			t.Error("should not run")
+		}))
+		start := time.Now()
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Contains(t, []string{`{"code":"a"}`, `{"code":"b"}`}, recorder.Body.String())
+	})
+
+	t.Run("step timeout", func(t *testing.T) {
+		n := MustNewNet(Step{Name: "slow", Timeout: 10 * time.Millisecond, Run: sleep(time.Second, nil)})
+		s := NewHttpServer()
+		s.Get("/", n.Build(func(c *Context) {}))
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	})
+
+	t.Run("parent cancelled", func(t *testing.T) {
+		n := MustNewNet(
+			Step{Name: "slow", Run: sleep(time.Second, nil)},
+			Step{Name: "after", Deps: []string{"slow"}, Run: func(ctx context.Context, c *Context) (any, error) {
+				t.Error("should not run")
+				return nil, nil
+			}},
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		c := &Context{Request: httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)}
+		assert.Equal(t, context.Canceled, n.Run(c))
+		_, ok := c.Get("after")
+		assert.False(t, ok)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		n := MustNewNet(Step{Name: "panic", Run: func(ctx context.Context, c *Context) (any, error) {
+			panic("oops")
+		}})
+		err := n.Run(&Context{Request: httptest.NewRequest(http.MethodGet, "/", nil)})
+		assert.Equal(t, "web: step 'panic' panic: oops", err.Error())
+	})
+}
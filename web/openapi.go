@@ -0,0 +1,583 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"html"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIInfo 文档的基本信息
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIConfig 在server上提供文档的配置
+type OpenAPIConfig struct {
+	Info OpenAPIInfo
+	// Path JSON文档的路由，默认是 /openapi.json
+	Path string
+	// YAMLPath YAML文档的路由，为空就不提供
+	YAMLPath string
+	// UIPath Swagger UI的路由，为空就不提供
+	UIPath string
+	// UIAssetsURL swagger-ui-dist 静态文件的地址，默认是 unpkg 上固定的版本
+	// 内网或者有CSP限制的时候可以换成自己托管的地址
+	UIAssetsURL string
+}
+
+// defaultUIAssetsURL 固定具体的版本，避免CDN上的新版本改变页面
+const defaultUIAssetsURL = "https://unpkg.com/swagger-ui-dist@5.17.14"
+
+// OpenAPIDocument OpenAPI 3 文档
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Example              any                       `json:"example,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty"`
+}
+
+// errorSchemaName DefaultErrorHandler 返回的JSON格式
+const errorSchemaName = "Error"
+
+// OpenAPI 根据注册的路由生成文档
+// - 路径参数转换成 {name}，正则作为 pattern，通配符转换成 {wildcard}
+// - 通过 HandleTyped 注册或者 WithTypes 声明的请求结构体生成参数和请求体，响应结构体生成200的响应
+// - 结构体的 description 和 example 标签会写到文档里面
+func (h *httpServer) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	g := &openAPIGenerator{schemas: map[string]*OpenAPISchema{}, types: map[string]reflect.Type{}}
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+	}
+	// 同一个路径和method只能有一个文档，生成没有指定版本的请求会用到的那个
+	// 默认版本优先，然后是没有声明版本的路由，都没有的时候用最新的版本，所有版本作为请求头参数的枚举
+	type opKey struct{ path, method string }
+	type versionedOp struct {
+		fullPath string
+		fallback bool
+		versions []string
+		metas    map[string]*routeMeta
+	}
+	versioned := map[opKey]*versionedOp{}
+	for _, r := range h.routes() {
+		meta := r.meta
+		if meta == nil {
+			meta = &routeMeta{}
+		}
+		if meta.hidden {
+			continue
+		}
+		path, params := openAPIPath(r.fullPath)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+		key := opKey{path: path, method: strings.ToLower(r.method)}
+		vo := versioned[key]
+		if vo == nil {
+			vo = &versionedOp{fullPath: r.fullPath, metas: map[string]*routeMeta{}}
+			versioned[key] = vo
+		}
+		if r.version == "" {
+			vo.fallback = true
+			doc.Paths[path][key.method] = g.operation(r.method, meta, params)
+			continue
+		}
+		vo.versions = append(vo.versions, r.version)
+		vo.metas[r.version] = meta
+	}
+	for key, vo := range versioned {
+		if len(vo.versions) == 0 {
+			continue
+		}
+		documented := ""
+		_, hasDefault := vo.metas[h.versionCfg.Default]
+		if hasDefault {
+			documented = h.versionCfg.Default
+		} else if !vo.fallback {
+			for _, v := range vo.versions {
+				if documented == "" || compareVersions(v, documented) > 0 {
+					documented = v
+				}
+			}
+		}
+		desc := "API version, this document describes requests without a version"
+		if documented != "" {
+			_, params := openAPIPath(vo.fullPath)
+			doc.Paths[key.path][key.method] = g.operation(strings.ToUpper(key.method), vo.metas[documented], params)
+			desc = "API version, this document describes version " + documented
+		}
+		enum := vo.versions
+		if vo.fallback {
+			// 没有指定版本的请求交给没有声明版本的路由处理
+			enum = append([]string{""}, enum...)
+		}
+		op := doc.Paths[key.path][key.method]
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:        h.versionCfg.Header,
+			In:          "header",
+			Description: desc,
+			// 默认版本没有注册并且没有兜底的路由的时候，不指定版本会返回400
+			Required: !hasDefault && !vo.fallback,
+			Schema:   &OpenAPISchema{Type: "string", Enum: enum},
+		})
+	}
+	g.schemas[errorSchemaName] = &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"code":    {Type: "integer"},
+			"message": {Type: "string"},
+		},
+	}
+	doc.Components = &OpenAPIComponents{Schemas: g.schemas}
+	return doc
+}
+
+// ServeOpenAPI 注册返回文档的路由，文档在请求的时候生成，所以之后注册的路由也会出现在文档里面
+func (h *httpServer) ServeOpenAPI(cfg OpenAPIConfig) {
+	if cfg.Path == "" {
+		cfg.Path = "/openapi.json"
+	}
+	h.addRoute(http.MethodGet, cfg.Path, func(c *Context) {
+		c.JSON(http.StatusOK, h.OpenAPI(cfg.Info))
+	}, WithHidden())
+
+	if cfg.YAMLPath != "" {
+		h.addRoute(http.MethodGet, cfg.YAMLPath, WrapE(func(c *Context) error {
+			data, err := openAPIYAML(h.OpenAPI(cfg.Info))
+			if err != nil {
+				return err
+			}
+			c.Writer.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+			c.RespStatusCode = http.StatusOK
+			c.RespData = data
+			return nil
+		}), WithHidden())
+	}
+
+	if cfg.UIPath != "" {
+		if cfg.UIAssetsURL == "" {
+			cfg.UIAssetsURL = defaultUIAssetsURL
+		}
+		assets := html.EscapeString(strings.TrimSuffix(cfg.UIAssetsURL, "/"))
+		url, _ := json.Marshal(cfg.Path)
+		page := []byte(fmt.Sprintf(swaggerUITemplate, html.EscapeString(cfg.Info.Title), assets, assets, url))
+		h.addRoute(http.MethodGet, cfg.UIPath, func(c *Context) {
+			c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+			c.RespStatusCode = http.StatusOK
+			c.RespData = page
+		}, WithHidden())
+	}
+}
+
+// openAPIYAML JSON是YAML的子集，先转成yaml.Node可以保留字段顺序
+func openAPIYAML(doc *OpenAPIDocument) ([]byte, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var n yaml.Node
+	if err = yaml.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&n)
+	return yaml.Marshal(&n)
+}
+
+// resetYAMLStyle 去掉从JSON带过来的引号和flow风格
+func resetYAMLStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+// openAPIPath 把注册的路由转换成OpenAPI的路径，同时返回路径参数
+func openAPIPath(fullPath string) (string, []*OpenAPIParameter) {
+	if fullPath == "/" {
+		return "/", nil
+	}
+	params := []*OpenAPIParameter{}
+	segs := strings.Split(strings.TrimPrefix(fullPath, "/"), "/")
+	wildcards := 0
+	for i, seg := range segs {
+		switch {
+		case seg[0] == ':':
+			name, regex := fetchRegexp(seg)
+			schema := &OpenAPISchema{Type: "string"}
+			if regex != nil {
+				schema.Pattern = regex.String()
+			}
+			segs[i] = "{" + name[1:] + "}"
+			params = append(params, &OpenAPIParameter{Name: name[1:], In: "path", Required: true, Schema: schema})
+		case seg == "*":
+			wildcards++
+			name := "wildcard"
+			if wildcards > 1 {
+				name += strconv.Itoa(wildcards)
+			}
+			segs[i] = "{" + name + "}"
+			params = append(params, &OpenAPIParameter{
+				Name:        name,
+				In:          "path",
+				Required:    true,
+				Description: "matches any segment",
+				Schema:      &OpenAPISchema{Type: "string"},
+			})
+		}
+	}
+	return "/" + strings.Join(segs, "/"), params
+}
+
+type openAPIGenerator struct {
+	schemas map[string]*OpenAPISchema
+	// 防止不同包里面同名的结构体互相覆盖
+	types map[string]reflect.Type
+}
+
+func (g *openAPIGenerator) operation(method string, meta *routeMeta, params []*OpenAPIParameter) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		Summary:     meta.summary,
+		Description: meta.description,
+		Tags:        meta.tags,
+		Deprecated:  meta.deprecated,
+		Parameters:  params,
+		Responses: map[string]*OpenAPIResponse{
+			"default": {
+				Description: "Error",
+				Content: map[string]*OpenAPIMediaType{
+					"application/json": {Schema: &OpenAPISchema{Ref: "#/components/schemas/" + errorSchemaName}},
+				},
+			},
+		},
+	}
+
+	if reqType := indirectType(meta.reqType); reqType != nil && reqType.Kind() == reflect.Struct {
+		body := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+		g.requestFields(op, body, reqType)
+		if len(body.Properties) > 0 && method != http.MethodGet && method != http.MethodHead {
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content:  map[string]*OpenAPIMediaType{"application/json": {Schema: body}},
+			}
+		}
+	}
+
+	ok := &OpenAPIResponse{Description: "OK"}
+	if meta.respType != nil {
+		ok.Content = map[string]*OpenAPIMediaType{"application/json": {Schema: g.schema(meta.respType)}}
+	}
+	op.Responses["200"] = ok
+	return op
+}
+
+// requestFields 请求结构体里面 path、query、header 标签的字段作为参数，其余字段作为请求体
+func (g *openAPIGenerator) requestFields(op *OpenAPIOperation, body *OpenAPISchema, typ reflect.Type) {
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		if !fd.IsExported() {
+			continue
+		}
+		if name, ok := fd.Tag.Lookup("path"); ok {
+			for _, p := range op.Parameters {
+				if p.In == "path" && p.Name == name {
+					pattern := p.Schema.Pattern
+					p.Schema = g.fieldSchema(fd)
+					p.Schema.Pattern = pattern
+					p.Schema.Description = ""
+					p.Description = fd.Tag.Get("description")
+				}
+			}
+			continue
+		}
+		if in, name, ok := paramTag(fd); ok {
+			schema := g.fieldSchema(fd)
+			schema.Description = ""
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{
+				Name:        name,
+				In:          in,
+				Description: fd.Tag.Get("description"),
+				Required:    hasRule(fd, "required"),
+				Schema:      schema,
+			})
+			continue
+		}
+		if fd.Anonymous && indirectType(fd.Type).Kind() == reflect.Struct && fd.Tag.Get("json") == "" {
+			g.requestFields(op, body, indirectType(fd.Type))
+			continue
+		}
+		g.addProperty(body, fd)
+	}
+}
+
+func paramTag(fd reflect.StructField) (string, string, bool) {
+	if name, ok := fd.Tag.Lookup("query"); ok {
+		return "query", name, true
+	}
+	if name, ok := fd.Tag.Lookup("header"); ok {
+		return "header", name, true
+	}
+	return "", "", false
+}
+
+// schema 命名的结构体放到 components 里面引用，避免重复和循环引用
+func (g *openAPIGenerator) schema(typ reflect.Type) *OpenAPISchema {
+	typ = indirectType(typ)
+	switch {
+	case typ == reflect.TypeOf(time.Time{}):
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return &OpenAPISchema{Type: "string", Format: "byte"}
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &OpenAPISchema{Type: "array", Items: g.schema(typ.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schema(typ.Elem())}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return g.structSchema(typ)
+		}
+		name := g.schemaName(typ)
+		if _, ok := g.schemas[name]; !ok {
+			// 先占位，处理自己引用自己的结构体
+			g.schemas[name] = &OpenAPISchema{}
+			*g.schemas[name] = *g.structSchema(typ)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	default:
+		return &OpenAPISchema{}
+	}
+}
+
+func (g *openAPIGenerator) schemaName(typ reflect.Type) string {
+	name := typ.Name()
+	for i := 2; ; i++ {
+		existed, ok := g.types[name]
+		if !ok {
+			g.types[name] = typ
+			return name
+		}
+		if existed == typ {
+			return name
+		}
+		name = typ.Name() + strconv.Itoa(i)
+	}
+}
+
+func (g *openAPIGenerator) structSchema(typ reflect.Type) *OpenAPISchema {
+	res := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		if !fd.IsExported() {
+			continue
+		}
+		if fd.Anonymous && indirectType(fd.Type).Kind() == reflect.Struct && fd.Tag.Get("json") == "" {
+			embedded := g.structSchema(indirectType(fd.Type))
+			for k, v := range embedded.Properties {
+				res.Properties[k] = v
+			}
+			res.Required = append(res.Required, embedded.Required...)
+			continue
+		}
+		g.addProperty(res, fd)
+	}
+	return res
+}
+
+func (g *openAPIGenerator) addProperty(obj *OpenAPISchema, fd reflect.StructField) {
+	name, _, _ := strings.Cut(fd.Tag.Get("json"), ",")
+	if name == "-" {
+		return
+	}
+	if name == "" {
+		name = fd.Name
+	}
+	obj.Properties[name] = g.fieldSchema(fd)
+	if hasRule(fd, "required") {
+		obj.Required = append(obj.Required, name)
+	}
+}
+
+// fieldSchema 字段的类型加上标签里面的描述、示例和校验规则
+func (g *openAPIGenerator) fieldSchema(fd reflect.StructField) *OpenAPISchema {
+	res := g.schema(fd.Type)
+	if res.Ref != "" {
+		// $ref 不允许有其它属性
+		return res
+	}
+	res.Description = fd.Tag.Get("description")
+	if example, ok := fd.Tag.Lookup("example"); ok {
+		res.Example = parseExample(res.Type, example)
+	}
+	for _, rule := range strings.Split(fd.Tag.Get("validate"), ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name != "min" && name != "max" {
+			continue
+		}
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			continue
+		}
+		setLimit(res, name == "min", limit)
+	}
+	return res
+}
+
+func setLimit(s *OpenAPISchema, isMin bool, limit float64) {
+	n := int(limit)
+	switch s.Type {
+	case "string":
+		if isMin {
+			s.MinLength = &n
+		} else {
+			s.MaxLength = &n
+		}
+	case "array":
+		if isMin {
+			s.MinItems = &n
+		} else {
+			s.MaxItems = &n
+		}
+	case "integer", "number":
+		if isMin {
+			s.Minimum = &limit
+		} else {
+			s.Maximum = &limit
+		}
+	}
+}
+
+func parseExample(typ, example string) any {
+	switch typ {
+	case "integer":
+		if v, err := strconv.ParseInt(example, 10, 64); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.ParseFloat(example, 64); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(example); err == nil {
+			return v
+		}
+	case "array", "object":
+		var v any
+		if err := json.Unmarshal([]byte(example), &v); err == nil {
+			return v
+		}
+	}
+	return example
+}
+
+func hasRule(fd reflect.StructField, rule string) bool {
+	for _, r := range strings.Split(fd.Tag.Get("validate"), ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+const swaggerUITemplate = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8"/>
+	<title>%s</title>
+	<link rel="stylesheet" href="%s/swagger-ui.css"/>
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="%s/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({url: %s, dom_id: "#swagger-ui"});
+	</script>
+</body>
+</html>
+`
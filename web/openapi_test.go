@@ -0,0 +1,110 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createOrderReq struct {
+	UserID int64    `path:"uid" description:"user id"`
+	Token  string   `header:"X-Token" validate:"required"`
+	Items  []string `json:"items" validate:"min=1" description:"sku list" example:"[\"a\",\"b\"]"`
+	Remark string   `json:"remark,omitempty" validate:"max=20"`
+}
+
+type orderResp struct {
+	ID     int64      `json:"id" example:"10"`
+	Parent *orderResp `json:"parent,omitempty"`
+}
+
+func TestServer_OpenAPI(t *testing.T) {
+	s := NewHttpServer()
+	g := s.Group("/user/:uid(^[0-9]+$)").Tags("order")
+	HandleTyped(g, http.MethodPost, "/order", func(ctx context.Context, req createOrderReq) (orderResp, error) {
+		return orderResp{}, nil
+	}, WithSummary("create order"))
+	s.Get("/static/*", func(c *Context) {}, WithDeprecated())
+	// 没有使用 Typed 的路由通过 WithTypes 声明
+	s.Get("/order/:id", func(c *Context) {}, WithTypes[struct{}, orderResp]())
+	s.ServeOpenAPI(OpenAPIConfig{
+		Info:     OpenAPIInfo{Title: "test", Version: "1.0"},
+		YAMLPath: "/openapi.yaml",
+		UIPath:   "/swagger",
+	})
+
+	doc := s.OpenAPI(OpenAPIInfo{Title: "test", Version: "1.0"})
+	// 文档自己的路由不出现在文档里面
+	assert.Len(t, doc.Paths, 3)
+
+	op := doc.Paths["/user/{uid}/order"]["post"]
+	require.NotNil(t, op)
+	assert.Equal(t, "create order", op.Summary)
+	assert.Equal(t, []string{"order"}, op.Tags)
+	require.Len(t, op.Parameters, 2)
+	assert.Equal(t, &OpenAPIParameter{
+		Name:        "uid",
+		In:          "path",
+		Description: "user id",
+		Required:    true,
+		Schema:      &OpenAPISchema{Type: "integer", Format: "int64", Pattern: "^[0-9]+$"},
+	}, op.Parameters[0])
+	assert.Equal(t, "header", op.Parameters[1].In)
+	assert.True(t, op.Parameters[1].Required)
+
+	body := op.RequestBody.Content["application/json"].Schema
+	assert.Len(t, body.Properties, 2)
+	assert.Equal(t, "sku list", body.Properties["items"].Description)
+	assert.Equal(t, []any{"a", "b"}, body.Properties["items"].Example)
+	assert.Equal(t, 1, *body.Properties["items"].MinItems)
+	assert.Equal(t, 20, *body.Properties["remark"].MaxLength)
+
+	assert.Equal(t, "#/components/schemas/orderResp", op.Responses["200"].Content["application/json"].Schema.Ref)
+	resp := doc.Components.Schemas["orderResp"]
+	assert.Equal(t, int64(10), resp.Properties["id"].Example)
+	assert.Equal(t, "#/components/schemas/orderResp", resp.Properties["parent"].Ref)
+
+	untyped := doc.Paths["/order/{id}"]["get"]
+	require.NotNil(t, untyped)
+	assert.Equal(t, "#/components/schemas/orderResp", untyped.Responses["200"].Content["application/json"].Schema.Ref)
+
+	static := doc.Paths["/static/{wildcard}"]["get"]
+	require.NotNil(t, static)
+	assert.True(t, static.Deprecated)
+
+	testcase := []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{path: "/openapi.json", contentType: "application/json; charset=utf-8", contains: `"openapi":"3.0.3"`},
+		{path: "/openapi.yaml", contentType: "application/yaml; charset=utf-8", contains: "openapi: 3.0.3"},
+		{path: "/swagger", contentType: "text/html; charset=utf-8", contains: `url: "/openapi.json"`},
+		{path: "/swagger", contentType: "text/html; charset=utf-8", contains: `src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js"`},
+	}
+	for _, tt := range testcase {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tt.contentType, recorder.Header().Get("Content-Type"))
+			assert.True(t, strings.Contains(recorder.Body.String(), tt.contains))
+		})
+	}
+
+	other := NewHttpServer()
+	other.ServeOpenAPI(OpenAPIConfig{UIPath: "/swagger", UIAssetsURL: "/static/swagger/"})
+	recorder := httptest.NewRecorder()
+	other.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/swagger", nil))
+	assert.Contains(t, recorder.Body.String(), `href="/static/swagger/swagger-ui.css"`)
+	assert.Contains(t, recorder.Body.String(), `src="/static/swagger/swagger-ui-bundle.js"`)
+
+	// 能够正常序列化
+	_, err := json.Marshal(doc)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Balancer 从可用的上游中选择一个
+type Balancer interface {
+	Pick(upstreams []*Upstream) *Upstream
+}
+
+// RoundRobin 轮询
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (r *roundRobin) Pick(upstreams []*Upstream) *Upstream {
+	n := atomic.AddUint64(&r.next, 1)
+	return upstreams[(n-1)%uint64(len(upstreams))]
+}
+
+// Weighted 平滑加权轮询，权重小于等于0的上游当作1
+func Weighted() Balancer {
+	return &weighted{current: map[*Upstream]int{}}
+}
+
+type weighted struct {
+	mu      sync.Mutex
+	current map[*Upstream]int
+}
+
+func (w *weighted) Pick(upstreams []*Upstream) *Upstream {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var best *Upstream
+	total := 0
+	for _, up := range upstreams {
+		weight := up.weight()
+		total += weight
+		w.current[up] += weight
+		if best == nil || w.current[up] > w.current[best] {
+			best = up
+		}
+	}
+	w.current[best] -= total
+	return best
+}
+
+// LeastConn 选择正在处理的请求最少的上游
+func LeastConn() Balancer {
+	return leastConn{}
+}
+
+type leastConn struct{}
+
+func (leastConn) Pick(upstreams []*Upstream) *Upstream {
+	var best *Upstream
+	for _, up := range upstreams {
+		if best == nil || up.Active() < best.Active() {
+			best = up
+		}
+	}
+	return best
+}
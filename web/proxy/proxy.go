@@ -0,0 +1,579 @@
+package proxy
+
+import (
+	"WebFramework/web"
+	"bytes"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream 上游服务
+type Upstream struct {
+	URL    *url.URL
+	Weight int
+
+	active int64
+	// 连续失败的次数
+	fails int32
+	// 被动健康检查认为不可用的截止时间
+	downUntil int64
+}
+
+// Active 正在处理的请求数
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+func (u *Upstream) weight() int {
+	if u.Weight <= 0 {
+		return 1
+	}
+	return u.Weight
+}
+
+func (u *Upstream) available(now time.Time) bool {
+	return atomic.LoadInt64(&u.downUntil) <= now.UnixNano()
+}
+
+// 逐跳的请求头，不能转发
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type Builder struct {
+	upstreams []*Upstream
+	balancer  Balancer
+	transport http.RoundTripper
+	// rewrite 返回转义之后的路径，保留请求里面的 %2F 之类的编码
+	rewrite func(c *web.Context) string
+
+	setHeaders        map[string]string
+	removeHeaders     []string
+	setRespHeaders    map[string]string
+	removeRespHeaders []string
+
+	retries        int
+	retryBodyLimit int64
+	maxFails       int
+	cooldown       time.Duration
+	trusted        []*net.IPNet
+
+	modifyRequest  []func(c *web.Context, req *http.Request) error
+	modifyResponse []func(c *web.Context, resp *http.Response, body []byte) ([]byte, error)
+}
+
+// NewBuilder 创建反向代理，默认轮询并且不重试，重试的时候最多缓存1MB的请求体
+func NewBuilder() *Builder {
+	return &Builder{
+		balancer:       RoundRobin(),
+		transport:      http.DefaultTransport,
+		setHeaders:     map[string]string{},
+		setRespHeaders: map[string]string{},
+		retryBodyLimit: 1 << 20,
+	}
+}
+
+// AddUpstream 添加上游，地址不合法的时候panic
+func (m *Builder) AddUpstream(rawURL string, weight int) *Builder {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		panic(fmt.Sprintf("invalid upstream url '%s'", rawURL))
+	}
+	m.upstreams = append(m.upstreams, &Upstream{URL: u, Weight: weight})
+	return m
+}
+
+func (m *Builder) Balancer(b Balancer) *Builder {
+	m.balancer = b
+	return m
+}
+
+func (m *Builder) Transport(t http.RoundTripper) *Builder {
+	m.transport = t
+	return m
+}
+
+// RewritePath 按照模板改写转发的路径
+// - :name 替换成路径参数
+// - * 替换成通配符匹配到的剩余路径
+// 例如路由 /api/:version/* 和模板 /:version/*，/api/v1/user/1 转发成 /v1/user/1
+func (m *Builder) RewritePath(template string) *Builder {
+	m.rewrite = func(c *web.Context) string {
+		segs := strings.Split(template, "/")
+		for i, seg := range segs {
+			switch {
+			case strings.HasPrefix(seg, ":"):
+				segs[i] = url.PathEscape(c.Params[seg[1:]])
+			case seg == "*":
+				segs[i] = wildcardPath(c)
+			}
+		}
+		return strings.Join(segs, "/")
+	}
+	return m
+}
+
+// StripPrefix 去掉路径的前缀之后转发
+func (m *Builder) StripPrefix(prefix string) *Builder {
+	m.rewrite = func(c *web.Context) string {
+		path := strings.TrimPrefix(c.Request.URL.EscapedPath(), (&url.URL{Path: prefix}).EscapedPath())
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return path
+	}
+	return m
+}
+
+// Rewrite 自定义转发的路径，fn 返回没有转义的路径
+func (m *Builder) Rewrite(fn func(c *web.Context) string) *Builder {
+	m.rewrite = func(c *web.Context) string {
+		return (&url.URL{Path: fn(c)}).EscapedPath()
+	}
+	return m
+}
+
+// SetHeader 设置转发的请求头
+func (m *Builder) SetHeader(key, val string) *Builder {
+	m.setHeaders[key] = val
+	return m
+}
+
+// RemoveHeader 删除转发的请求头
+func (m *Builder) RemoveHeader(key string) *Builder {
+	m.removeHeaders = append(m.removeHeaders, key)
+	return m
+}
+
+// SetResponseHeader 设置返回的响应头
+func (m *Builder) SetResponseHeader(key, val string) *Builder {
+	m.setRespHeaders[key] = val
+	return m
+}
+
+// RemoveResponseHeader 删除上游返回的响应头
+func (m *Builder) RemoveResponseHeader(key string) *Builder {
+	m.removeRespHeaders = append(m.removeRespHeaders, key)
+	return m
+}
+
+// Retries 幂等的请求在连接失败或者上游返回502、503、504的时候换一个上游重试
+func (m *Builder) Retries(n int) *Builder {
+	m.retries = n
+	return m
+}
+
+// RetryBodyLimit 重试需要缓存请求体，超过 limit 字节的请求体直接转发，不再重试
+func (m *Builder) RetryBodyLimit(limit int64) *Builder {
+	m.retryBodyLimit = limit
+	return m
+}
+
+// TrustedProxies 来自这些网段的请求才保留 X-Forwarded-For、X-Forwarded-Host 和 X-Forwarded-Proto
+// 其它请求的这些头会被覆盖，地址不合法的时候panic
+func (m *Builder) TrustedProxies(cidrs ...string) *Builder {
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy '%s'", cidr))
+		}
+		m.trusted = append(m.trusted, ipNet)
+	}
+	return m
+}
+
+// PassiveHealthCheck 连续失败 maxFails 次之后，cooldown 时间内不再选择这个上游
+// 连接失败和5xx的响应算失败
+func (m *Builder) PassiveHealthCheck(maxFails int, cooldown time.Duration) *Builder {
+	m.maxFails = maxFails
+	m.cooldown = cooldown
+	return m
+}
+
+// ModifyRequest 转发之前修改请求，返回error会中止转发
+func (m *Builder) ModifyRequest(fn func(c *web.Context, req *http.Request) error) *Builder {
+	m.modifyRequest = append(m.modifyRequest, fn)
+	return m
+}
+
+// ModifyResponse 修改上游返回的响应体，返回的body会作为最终的响应
+// 设置之后响应体会被完整读到内存里面，否则直接流式转发
+func (m *Builder) ModifyResponse(fn func(c *web.Context, resp *http.Response, body []byte) ([]byte, error)) *Builder {
+	m.modifyResponse = append(m.modifyResponse, fn)
+	return m
+}
+
+// Handler 一般注册在通配符路由上，例如 s.Get("/api/*", builder.Handler())
+func (m *Builder) Handler() web.HandleFunc {
+	if len(m.upstreams) == 0 {
+		panic("proxy: no upstream")
+	}
+	return web.WrapE(m.serve)
+}
+
+func (m *Builder) serve(c *web.Context) error {
+	attempts := 1
+	if isIdempotent(c.Request.Method) {
+		attempts += m.retries
+	}
+	body, err := m.requestBody(c, attempts > 1)
+	if err != nil {
+		return web.NewHTTPError(http.StatusBadRequest, "").Wrap(err)
+	}
+	if !body.replayable() {
+		attempts = 1
+	}
+
+	tried := map[*Upstream]bool{}
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		up := m.pick(tried)
+		tried[up] = true
+		resp, err := m.roundTrip(c, up, body)
+		if err != nil {
+			lastErr = err
+			var hookErr *hookError
+			// 本地的错误和客户端断开不是上游的问题
+			if errors.As(err, &hookErr) || c.Request.Context().Err() != nil {
+				break
+			}
+			m.markFailure(up)
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			m.markFailure(up)
+		} else {
+			m.markSuccess(up)
+		}
+		if i < attempts-1 && isRetryableStatus(resp.StatusCode) {
+			_ = resp.Body.Close()
+			lastErr = fmt.Errorf("proxy: upstream %s returned %d", up.URL.Host, resp.StatusCode)
+			continue
+		}
+		return m.writeResponse(c, resp)
+	}
+	return web.NewHTTPError(http.StatusBadGateway, "").Wrap(lastErr)
+}
+
+// requestBody 需要重试的时候缓存不超过 retryBodyLimit 的请求体，其它情况直接转发原始的请求体
+type requestBody struct {
+	data   []byte
+	stream io.Reader
+	length int64
+}
+
+func (r requestBody) replayable() bool {
+	return r.stream == nil
+}
+
+func (r requestBody) reader() io.Reader {
+	if r.stream != nil {
+		return r.stream
+	}
+	if r.data == nil {
+		return http.NoBody
+	}
+	return bytes.NewReader(r.data)
+}
+
+func (m *Builder) requestBody(c *web.Context, retry bool) (requestBody, error) {
+	body := c.Request.Body
+	if body == nil || body == http.NoBody {
+		return requestBody{}, nil
+	}
+	if !retry {
+		return requestBody{stream: body, length: c.Request.ContentLength}, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(body, m.retryBodyLimit+1))
+	if err != nil {
+		return requestBody{}, err
+	}
+	if int64(len(data)) > m.retryBodyLimit {
+		return requestBody{stream: io.MultiReader(bytes.NewReader(data), body), length: c.Request.ContentLength}, nil
+	}
+	return requestBody{data: data, length: int64(len(data))}, nil
+}
+
+// pick 优先选择可用并且还没有试过的上游
+func (m *Builder) pick(tried map[*Upstream]bool) *Upstream {
+	now := time.Now()
+	candidates := make([]*Upstream, 0, len(m.upstreams))
+	for _, up := range m.upstreams {
+		if up.available(now) && !tried[up] {
+			candidates = append(candidates, up)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, up := range m.upstreams {
+			if up.available(now) {
+				candidates = append(candidates, up)
+			}
+		}
+	}
+	// 全都不可用的时候还是要尝试
+	if len(candidates) == 0 {
+		candidates = m.upstreams
+	}
+	return m.balancer.Pick(candidates)
+}
+
+type hookError struct {
+	err error
+}
+
+func (h *hookError) Error() string {
+	return h.err.Error()
+}
+
+func (h *hookError) Unwrap() error {
+	return h.err
+}
+
+func (m *Builder) roundTrip(c *web.Context, up *Upstream, body requestBody) (*http.Response, error) {
+	rawPath := c.Request.URL.EscapedPath()
+	if m.rewrite != nil {
+		rawPath = m.rewrite(c)
+	}
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, &hookError{err: err}
+	}
+	// 和 httputil.ReverseProxy 一样，解码和转义的路径分别拼接，上游的查询参数放在前面
+	target := *up.URL
+	target.Path = singleJoiningSlash(up.URL.Path, path)
+	target.RawPath = singleJoiningSlash(up.URL.EscapedPath(), rawPath)
+	if up.URL.RawQuery == "" || c.Request.URL.RawQuery == "" {
+		target.RawQuery = up.URL.RawQuery + c.Request.URL.RawQuery
+	} else {
+		target.RawQuery = up.URL.RawQuery + "&" + c.Request.URL.RawQuery
+	}
+
+	ctx := c.Request.Context()
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, target.String(), body.reader())
+	if err != nil {
+		return nil, &hookError{err: err}
+	}
+	req.ContentLength = body.length
+	req.Header = c.Request.Header.Clone()
+	removeHopHeaders(req.Header)
+	setForwardedHeaders(c.Request, req, m.trustedProxy(c.Request.RemoteAddr))
+	for _, key := range m.removeHeaders {
+		req.Header.Del(key)
+	}
+	for key, val := range m.setHeaders {
+		req.Header.Set(key, val)
+	}
+	// 把 opentelemetry 中间件放到 context 里面的 span 传给上游
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	for _, fn := range m.modifyRequest {
+		if err = fn(c, req); err != nil {
+			return nil, &hookError{err: err}
+		}
+	}
+
+	atomic.AddInt64(&up.active, 1)
+	defer atomic.AddInt64(&up.active, -1)
+	return m.transport.RoundTrip(req)
+}
+
+func (m *Builder) writeResponse(c *web.Context, resp *http.Response) error {
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	if len(m.modifyResponse) > 0 {
+		return m.writeBuffered(c, resp)
+	}
+
+	m.copyHeaders(c, resp.Header)
+	w := c.Writer
+	w.WriteHeader(resp.StatusCode)
+	c.RespStatusCode = resp.StatusCode
+	// 响应头已经发出去了，后面 flushResp 再写响应头会被忽略
+	c.Writer = streamedWriter{ResponseWriter: w}
+	if err := copyFlush(w, resp.Body); err != nil {
+		// 和 httputil.ReverseProxy 一样中断连接，让客户端知道响应不完整
+		// 自定义的 recovery 中间件需要把 http.ErrAbortHandler 重新panic出去，不要再写响应
+		c.Abort()
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// writeBuffered 读取完整的响应体交给 ModifyResponse 修改
+func (m *Builder) writeBuffered(c *web.Context, resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return web.NewHTTPError(http.StatusBadGateway, "").Wrap(err)
+	}
+	for _, fn := range m.modifyResponse {
+		if body, err = fn(c, resp, body); err != nil {
+			return web.NewHTTPError(http.StatusBadGateway, "").Wrap(err)
+		}
+	}
+
+	// 响应体可能被修改了，长度交给 net/http 重新计算
+	resp.Header.Del("Content-Length")
+	m.copyHeaders(c, resp.Header)
+	c.RespStatusCode = resp.StatusCode
+	c.RespData = body
+	return nil
+}
+
+func (m *Builder) copyHeaders(c *web.Context, src http.Header) {
+	header := c.Writer.Header()
+	for key, vals := range src {
+		header[key] = vals
+	}
+	for _, key := range m.removeRespHeaders {
+		header.Del(key)
+	}
+	for key, val := range m.setRespHeaders {
+		header.Set(key, val)
+	}
+}
+
+// copyFlush 每次写完都 Flush，SSE 之类的流式响应能够及时发给客户端
+func copyFlush(w http.ResponseWriter, body io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamedWriter 已经直接写了响应之后使用
+type streamedWriter struct {
+	http.ResponseWriter
+}
+
+func (streamedWriter) WriteHeader(int) {}
+
+func (m *Builder) markSuccess(up *Upstream) {
+	atomic.StoreInt32(&up.fails, 0)
+}
+
+func (m *Builder) markFailure(up *Upstream) {
+	fails := atomic.AddInt32(&up.fails, 1)
+	if m.maxFails > 0 && int(fails) >= m.maxFails {
+		atomic.StoreInt64(&up.downUntil, time.Now().Add(m.cooldown).UnixNano())
+		atomic.StoreInt32(&up.fails, 0)
+	}
+}
+
+// trustedProxy 请求是否来自可信的代理
+func (m *Builder) trustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range m.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// setForwardedHeaders 只有来自可信代理的请求才保留客户端传过来的值
+func setForwardedHeaders(in *http.Request, out *http.Request, trusted bool) {
+	if ip, _, err := net.SplitHostPort(in.RemoteAddr); err == nil {
+		if prior := in.Header.Values("X-Forwarded-For"); trusted && len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		out.Header.Set("X-Forwarded-For", ip)
+	} else if !trusted {
+		out.Header.Del("X-Forwarded-For")
+	}
+	if !trusted || out.Header.Get("X-Forwarded-Host") == "" {
+		out.Header.Set("X-Forwarded-Host", in.Host)
+	}
+	if !trusted || out.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if in.TLS != nil {
+			proto = "https"
+		}
+		out.Header.Set("X-Forwarded-Proto", proto)
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	// Connection 里面列出的头也是逐跳的
+	for _, field := range header.Values("Connection") {
+		for _, key := range strings.Split(field, ",") {
+			header.Del(strings.TrimSpace(key))
+		}
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// wildcardPath 通配符匹配到的剩余路径，保持转义
+func wildcardPath(c *web.Context) string {
+	routeSegs := strings.Split(strings.TrimPrefix(c.MatchedRoute, "/"), "/")
+	segs := strings.Split(strings.TrimPrefix(c.Request.URL.EscapedPath(), "/"), "/")
+	for i, seg := range routeSegs {
+		if seg == "*" && i < len(segs) {
+			return strings.Join(segs[i:], "/")
+		}
+	}
+	return ""
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
@@ -0,0 +1,367 @@
+package proxy
+
+import (
+	"WebFramework/web"
+	"WebFramework/web/middlewares/recovery"
+	"WebFramework/web/webtest"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "1")
+		w.Header().Set("X-Secret", "1")
+		w.Header().Set("Connection", "keep-alive")
+		_, _ = fmt.Fprintf(w, "%s %s?%s body=%s xff=%s host=%s proto=%s token=%s debug=%s",
+			r.Method, r.URL.Path, r.URL.RawQuery, body,
+			r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Host"),
+			r.Header.Get("X-Forwarded-Proto"), r.Header.Get("X-Token"), r.Header.Get("X-Debug"))
+	}))
+	defer upstream.Close()
+
+	s := web.NewHttpServer()
+	s.Post("/api/:version/*", NewBuilder().
+		AddUpstream(upstream.URL+"/base", 1).
+		RewritePath("/:version/*").
+		SetHeader("X-Token", "abc").
+		RemoveHeader("X-Debug").
+		RemoveResponseHeader("X-Secret").
+		SetResponseHeader("X-Proxy", "web").
+		ModifyResponse(func(c *web.Context, resp *http.Response, body []byte) ([]byte, error) {
+			return append(body, []byte(" modified")...), nil
+		}).
+		Handler())
+
+	resp := webtest.New(t, s).Post("/api/v1/user/1").
+		WithQuery("a", "b").
+		WithHeader("X-Debug", "1").
+		WithHeader("X-Forwarded-For", "10.0.0.1").
+		WithBody("text/plain", []byte("hello")).
+		Expect().
+		Status(http.StatusOK).
+		Header("X-Upstream", "1").
+		Header("X-Secret", "").
+		Header("X-Proxy", "web").
+		Header("Connection", "").
+		Body("POST /base/v1/user/1?a=b body=hello xff=192.0.2.1 host=example.com proto=http token=abc debug= modified")
+	assert.Equal(t, "/api/:version/*", resp.Context().MatchedRoute)
+}
+
+func TestProxy_EscapedPath(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s?%s", r.URL.EscapedPath(), r.URL.RawQuery)
+	}))
+	defer upstream.Close()
+
+	s := web.NewHttpServer()
+	s.Get("/files/*", NewBuilder().AddUpstream(upstream.URL+"/base?key=v", 1).Handler())
+	s.Get("/strip/*", NewBuilder().AddUpstream(upstream.URL, 1).StripPrefix("/strip").Handler())
+	s.Get("/api/:version/*", NewBuilder().AddUpstream(upstream.URL, 1).RewritePath("/:version/*").Handler())
+	s.Get("/custom/*", NewBuilder().AddUpstream(upstream.URL, 1).Rewrite(func(c *web.Context) string {
+		return "/a b"
+	}).Handler())
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{name: "merge query", path: "/files/a%2Fb?x=1", wantBody: "/base/files/a%2Fb?key=v&x=1"},
+		{name: "upstream query only", path: "/files/a", wantBody: "/base/files/a?key=v"},
+		{name: "strip prefix", path: "/strip/a%2Fb", wantBody: "/a%2Fb?"},
+		{name: "rewrite path", path: "/api/v1/a%2Fb", wantBody: "/v1/a%2Fb?"},
+		{name: "custom rewrite", path: "/custom/x", wantBody: "/a%20b?"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			webtest.New(t, s).Get(tc.path).Expect().Status(http.StatusOK).Body(tc.wantBody)
+		})
+	}
+}
+
+func TestProxy_TrustedProxies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("X-Forwarded-For"),
+			r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		name     string
+		trusted  []string
+		wantBody string
+	}{
+		{name: "untrusted", wantBody: "192.0.2.1|example.com|http"},
+		{name: "other network", trusted: []string{"10.0.0.0/8"}, wantBody: "192.0.2.1|example.com|http"},
+		{name: "trusted", trusted: []string{"192.0.2.0/24"}, wantBody: "10.0.0.1, 192.0.2.1|origin.com|https"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := web.NewHttpServer()
+			s.Get("/*", NewBuilder().AddUpstream(upstream.URL, 1).TrustedProxies(tc.trusted...).Handler())
+			webtest.New(t, s).Get("/user").
+				WithHeader("X-Forwarded-For", "10.0.0.1").
+				WithHeader("X-Forwarded-Host", "origin.com").
+				WithHeader("X-Forwarded-Proto", "https").
+				Expect().Body(tc.wantBody)
+		})
+	}
+	assert.Panics(t, func() {
+		NewBuilder().TrustedProxies("10.0.0.1")
+	})
+}
+
+func TestProxy_Stream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	var status int
+	s := web.NewHttpServer(web.WithMiddleware(func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			next(c)
+			status = c.RespStatusCode
+		}
+	}))
+	s.Get("/*", NewBuilder().AddUpstream(upstream.URL, 1).Handler())
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	// 上游还没有结束，第一个事件就已经转发过来了
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n", line)
+
+	release <- struct{}{}
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "\ndata: 2\n\n", string(rest))
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestProxy_StreamAborted(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		// 响应体还没写完上游就断开了
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		_ = conn.Close()
+	}))
+	defer upstream.Close()
+
+	var logged int32
+	s := web.NewHttpServer(web.WithMiddleware(recovery.NewBuilder(recovery.Options{
+		StatusCode: http.StatusInternalServerError,
+		Data:       []byte("panic"),
+		Log: func(c *web.Context) {
+			atomic.StoreInt32(&logged, 1)
+		},
+	}).Build()))
+	s.Get("/*", NewBuilder().AddUpstream(upstream.URL, 1).Handler())
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// 客户端能够发现响应不完整，recovery 不会再追加500的响应
+	body, err := io.ReadAll(resp.Body)
+	assert.Error(t, err)
+	assert.Equal(t, "partial", string(body))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&logged))
+}
+
+func TestProxy_RetryBodyLimit(t *testing.T) {
+	var badHits, goodHits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badHits, 1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodHits, 1)
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer good.Close()
+
+	s := web.NewHttpServer()
+	s.Put("/*", NewBuilder().AddUpstream(bad.URL, 1).AddUpstream(good.URL, 1).
+		Retries(1).RetryBodyLimit(5).Handler())
+	client := webtest.New(t, s)
+
+	// 不超过限制的请求体缓存起来重试
+	client.Put("/user").WithBody("text/plain", []byte("hello")).Expect().
+		Status(http.StatusOK).Body("hello")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&badHits))
+	// 超过限制的请求体直接转发，不再重试
+	client.Put("/user").WithBody("text/plain", []byte("hello world")).Expect().
+		Status(http.StatusServiceUnavailable)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&badHits))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&goodHits))
+}
+
+func TestProxy_Retry(t *testing.T) {
+	var badHits, goodHits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodHits, 1)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer good.Close()
+
+	builder := NewBuilder().
+		AddUpstream(bad.URL, 1).
+		AddUpstream(good.URL, 1).
+		Retries(1).
+		PassiveHealthCheck(2, time.Minute)
+	s := web.NewHttpServer()
+	s.Get("/*", builder.Handler())
+	s.Post("/*", builder.Handler())
+	client := webtest.New(t, s)
+
+	for i := 0; i < 4; i++ {
+		client.Get("/user").Expect().Status(http.StatusOK).Body("ok")
+	}
+	// bad 连续失败两次之后被摘掉
+	assert.Equal(t, int32(2), atomic.LoadInt32(&badHits))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&goodHits))
+
+	// POST 不是幂等的，不重试，直接返回上游的响应
+	builder.upstreams[0].downUntil = 0
+	builder.balancer = RoundRobin()
+	client.Post("/user").Expect().Status(http.StatusServiceUnavailable)
+	client.Post("/user").Expect().Status(http.StatusOK)
+}
+
+func TestProxy_HookError(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer upstream.Close()
+
+	s := web.NewHttpServer()
+	s.Get("/*", NewBuilder().AddUpstream(upstream.URL, 1).Retries(3).
+		ModifyRequest(func(c *web.Context, req *http.Request) error {
+			return errors.New("denied")
+		}).Handler())
+	webtest.New(t, s).Get("/user").Expect().Status(http.StatusBadGateway)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hits))
+}
+
+// 本地的错误和4xx不会让上游被摘掉
+func TestProxy_PassiveHealthCheck(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	deny := true
+	builder := NewBuilder().AddUpstream(upstream.URL, 1).PassiveHealthCheck(1, time.Minute).
+		ModifyRequest(func(c *web.Context, req *http.Request) error {
+			if deny {
+				return errors.New("denied")
+			}
+			return nil
+		})
+	s := web.NewHttpServer()
+	s.Get("/*", builder.Handler())
+	client := webtest.New(t, s)
+
+	client.Get("/user").Expect().Status(http.StatusBadGateway)
+	deny = false
+	client.Get("/user").Expect().Status(http.StatusNotFound)
+	assert.True(t, builder.upstreams[0].available(time.Now()))
+}
+
+// 保留 opentelemetry 中间件放进 context 的 trace
+func TestProxy_Trace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Traceparent")))
+	}))
+	defer upstream.Close()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+
+	s := web.NewHttpServer(web.WithMiddleware(func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			c.Request = c.Request.WithContext(trace.ContextWithSpanContext(context.Background(), sc))
+			next(c)
+		}
+	}))
+	s.Get("/*", NewBuilder().AddUpstream(upstream.URL, 1).Handler())
+	webtest.New(t, s).Get("/user").Expect().
+		Body("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+}
+
+func TestBalancer(t *testing.T) {
+	a := &Upstream{Weight: 5}
+	b := &Upstream{Weight: 1}
+	c := &Upstream{Weight: 1}
+	ups := []*Upstream{a, b, c}
+
+	count := map[*Upstream]int{}
+	w := Weighted()
+	for i := 0; i < 7; i++ {
+		count[w.Pick(ups)]++
+	}
+	assert.Equal(t, map[*Upstream]int{a: 5, b: 1, c: 1}, count)
+
+	rr := RoundRobin()
+	assert.Equal(t, []*Upstream{a, b, c, a}, []*Upstream{rr.Pick(ups), rr.Pick(ups), rr.Pick(ups), rr.Pick(ups)})
+
+	a.active, b.active, c.active = 3, 1, 2
+	assert.Equal(t, b, LeastConn().Pick(ups))
+}
+
+func TestStripPrefix(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer upstream.Close()
+	s := web.NewHttpServer()
+	s.Get("/api/*", NewBuilder().AddUpstream(upstream.URL, 1).StripPrefix("/api").Handler())
+	webtest.New(t, s).Get("/api/user/1").Expect().Body("/user/1")
+	assert.Panics(t, func() {
+		NewBuilder().AddUpstream("localhost", 1)
+	})
+}
@@ -3,13 +3,17 @@ package web
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 // 路由树
 type router struct {
 	trees map[string]*node
+	// server级别的中间件，和路由树一起整体替换
+	middlewares []Middleware
 }
 
 func newRouter() *router {
@@ -27,6 +31,75 @@ type node struct {
 	pathParam   *node
 	regExpr     *regexp.Regexp
 	middlewares []Middleware
+	meta        *routeMeta
+	// 通过 WithVersion 注册的不同版本
+	versions map[string]*versionedRoute
+}
+
+// RouteOption 注册路由的时候附加的信息，例如生成文档用到的描述
+type RouteOption func(m *routeMeta)
+
+type routeMeta struct {
+	summary     string
+	description string
+	tags        []string
+	reqType     reflect.Type
+	respType    reflect.Type
+	deprecated  bool
+	version     string
+	// 不出现在文档里面
+	hidden bool
+}
+
+func newRouteMeta(opts []RouteOption) *routeMeta {
+	res := &routeMeta{}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// WithSummary 路由的简介
+func WithSummary(summary string) RouteOption {
+	return func(m *routeMeta) {
+		m.summary = summary
+	}
+}
+
+// WithDescription 路由的详细描述
+func WithDescription(description string) RouteOption {
+	return func(m *routeMeta) {
+		m.description = description
+	}
+}
+
+// WithTags 路由的标签，路由分组上的标签会自动加上
+func WithTags(tags ...string) RouteOption {
+	return func(m *routeMeta) {
+		m.tags = append(m.tags, tags...)
+	}
+}
+
+// WithDeprecated 标记路由已经废弃
+func WithDeprecated() RouteOption {
+	return func(m *routeMeta) {
+		m.deprecated = true
+	}
+}
+
+// WithTypes 声明请求和响应的结构体，给没有通过 HandleTyped 注册的路由生成文档
+func WithTypes[Req, Resp any]() RouteOption {
+	return func(m *routeMeta) {
+		m.reqType = reflect.TypeOf((*Req)(nil)).Elem()
+		m.respType = reflect.TypeOf((*Resp)(nil)).Elem()
+	}
+}
+
+// WithHidden 路由不出现在文档里面，例如健康检查和文档本身
+func WithHidden() RouteOption {
+	return func(m *routeMeta) {
+		m.hidden = true
+	}
 }
 
 // =========================================================================================================
@@ -39,15 +112,12 @@ type node struct {
 // - 同名路径参数，在路由匹配的时候，值会被覆盖。例如 /user/:id/abc/:id，那么 /user/123/abc/456 最终 id = 456
 // - 可以注册 /user/:a/:b   /user/:a
 // - 不能注册 /user/:a/:b   /user/:c
-func (r *router) addRoute(httpMethod, path string, handleFunc HandleFunc) {
+func (r *router) addRoute(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption) {
 	isValidPath(path)
 	root := r.getRootOrCreate(httpMethod)
 
 	if path == "/" {
-		if root.handleFunc != nil {
-			panic(fmt.Sprintf("'%s' conflict with existed path", path))
-		}
-		root.handleFunc = handleFunc
+		root.setHandler(path, handleFunc, newRouteMeta(opts), false)
 		root.fullPath = "/"
 		fmt.Println("/")
 		return
@@ -62,10 +132,7 @@ func (r *router) addRoute(httpMethod, path string, handleFunc HandleFunc) {
 		cur = cur.getChildOrCreate(seg)
 	}
 
-	if cur.handleFunc != nil {
-		panic(fmt.Sprintf("'%s' conflict with existed path", path))
-	}
-	cur.handleFunc = handleFunc
+	cur.setHandler(path, handleFunc, newRouteMeta(opts), false)
 	fmt.Println(cur.fullPath)
 }
 
@@ -263,7 +330,7 @@ func (n *node) getMatchInfo(segs []string) (*matchInfo, bool) {
 			res.params[child.path[1:]] = seg
 		}
 		// 支持末尾通配符匹配多段
-		if child.path == "*" && isLeaf(child) && child.handleFunc != nil {
+		if child.path == "*" && isLeaf(child) && child.hasHandler() {
 			res.node = child
 			return res, true
 		}
@@ -353,3 +420,187 @@ func (r *router) addMiddlewares(httpMethod, path string, middlewares ...Middlewa
 	matched.middlewares = append(matched.middlewares, middlewares...)
 	return nil
 }
+
+// =========================================================================================================
+
+// 已经注册的路由
+type routeInfo struct {
+	method string
+	*node
+	// 版本路由每个版本是一条记录
+	version string
+	meta    *routeMeta
+}
+
+// allowedMethods 能匹配上 path 的所有method
+func (r *router) allowedMethods(path string) []string {
+	res := []string{}
+	for method := range r.trees {
+		if match, ok := r.findRoute(method, path); ok && match.hasHandler() {
+			res = append(res, method)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// routes 按照method和路径排序返回所有注册了业务逻辑的路由
+func (r *router) routes() []routeInfo {
+	res := []routeInfo{}
+	for method, root := range r.trees {
+		queue := []*node{root}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			if cur.handleFunc != nil {
+				res = append(res, routeInfo{method: method, node: cur, meta: cur.meta})
+			}
+			for _, v := range cur.sortedVersions() {
+				res = append(res, routeInfo{method: method, node: cur, version: v, meta: cur.versions[v].meta})
+			}
+			for _, child := range cur.children {
+				queue = append(queue, child)
+			}
+			if cur.pathParam != nil {
+				queue = append(queue, cur.pathParam)
+			}
+			if cur.wildcard != nil {
+				queue = append(queue, cur.wildcard)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].fullPath != res[j].fullPath {
+			return res[i].fullPath < res[j].fullPath
+		}
+		if res[i].method != res[j].method {
+			return res[i].method < res[j].method
+		}
+		return compareVersions(res[i].version, res[j].version) < 0
+	})
+	return res
+}
+
+// =========================================================================================================
+// 运行时修改路由：server 开始处理请求之后路由树是写时复制的，修改的时候先复制一份，修改完之后整体替换
+
+// clone 深复制整棵路由树，正则和路由描述不会被修改，可以共享
+func (r *router) clone() *router {
+	res := &router{
+		trees:       make(map[string]*node, len(r.trees)),
+		middlewares: append([]Middleware(nil), r.middlewares...),
+	}
+	for method, root := range r.trees {
+		res.trees[method] = root.clone()
+	}
+	return res
+}
+
+func (n *node) clone() *node {
+	if n == nil {
+		return nil
+	}
+	res := *n
+	res.children = make(map[string]*node, len(n.children))
+	for k, child := range n.children {
+		res.children[k] = child.clone()
+	}
+	res.wildcard = n.wildcard.clone()
+	res.pathParam = n.pathParam.clone()
+	res.middlewares = append([]Middleware(nil), n.middlewares...)
+	if n.versions != nil {
+		res.versions = make(map[string]*versionedRoute, len(n.versions))
+		for k, v := range n.versions {
+			res.versions[k] = v
+		}
+	}
+	return &res
+}
+
+// replaceRoute 注册路由，已经存在的时候直接覆盖
+func (r *router) replaceRoute(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	isValidPath(path)
+	cur := r.getRootOrCreate(httpMethod)
+	if path == "/" {
+		cur.fullPath = "/"
+	} else {
+		for _, seg := range strings.Split(path, "/")[1:] {
+			if seg == "" {
+				panic("invalid path")
+			}
+			cur = cur.getChildOrCreate(seg)
+		}
+	}
+	cur.setHandler(path, handleFunc, newRouteMeta(opts), true)
+}
+
+// removeRoute 删除注册的路由，path 必须和注册的时候一致，例如 /user/:id(^[0-9]+$)
+// 所有版本都会被删除
+// 没有业务逻辑也没有中间件的节点会被一起删掉
+func (r *router) removeRoute(httpMethod, path string) error {
+	root, ok := r.trees[httpMethod]
+	if !ok {
+		return fmt.Errorf("[method:%s] [path:%s] not exist", httpMethod, path)
+	}
+	if path == "/" {
+		if !root.hasHandler() {
+			return fmt.Errorf("[method:%s] [path:%s] not exist", httpMethod, path)
+		}
+		root.clearHandler()
+		return nil
+	}
+	if !root.remove(strings.Split(path, "/")[1:]) {
+		return fmt.Errorf("[method:%s] [path:%s] not exist", httpMethod, path)
+	}
+	return nil
+}
+
+// remove 递归删除，返回是否找到了路由
+func (n *node) remove(segs []string) bool {
+	if len(segs) == 0 {
+		if !n.hasHandler() {
+			return false
+		}
+		n.clearHandler()
+		return true
+	}
+
+	seg := segs[0]
+	var child *node
+	switch {
+	case seg != "" && seg[0] == ':':
+		name, _ := fetchRegexp(seg)
+		if n.pathParam != nil && n.pathParam.path == name {
+			child = n.pathParam
+		}
+	case seg == "*":
+		child = n.wildcard
+	default:
+		child = n.children[seg]
+	}
+	if child == nil || !child.remove(segs[1:]) {
+		return false
+	}
+
+	if !child.hasHandler() && len(child.middlewares) == 0 && isLeaf(child) {
+		switch child {
+		case n.pathParam:
+			n.pathParam = nil
+		case n.wildcard:
+			n.wildcard = nil
+		default:
+			delete(n.children, seg)
+		}
+	}
+	return true
+}
+
+// setMiddlewares 替换节点上的路由中间件，middlewares 为空的时候就是删除
+func (r *router) setMiddlewares(httpMethod, path string, middlewares ...Middleware) error {
+	matched, ok := r.findRoute(httpMethod, path)
+	if !ok {
+		return fmt.Errorf("[method:%s] [path:%s] not exist", httpMethod, path)
+	}
+	matched.middlewares = append([]Middleware(nil), middlewares...)
+	return nil
+}
@@ -1,9 +1,15 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 确保一定实现接口
@@ -15,24 +21,61 @@ type HandleFunc func(c *Context)
 type Server interface {
 	http.Handler
 	Start(addr string) error
-	addRoute(httpMethod, path string, handleFunc HandleFunc)
+	Shutdown(ctx context.Context) error
+	addRoute(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption)
 	addMiddlewares(httpMethod, path string, middlewares ...Middleware) error
 }
 
 // 默认实现类
 type httpServer struct {
-	*router
-	middlewares []Middleware
-	log         func(msg string, args ...any)
+	// 路由树，开始处理请求之后每次修改都整体替换，运行时修改路由不会和处理请求并发冲突
+	current  atomic.Value
+	routerMu sync.Mutex
+	// 是否已经开始处理请求
+	serving int32
+
+	log          func(msg string, args ...any)
+	errorHandler ErrorHandler
+	versionCfg   VersionConfig
+
+	// 生命周期
+	mu            sync.Mutex
+	servers       []*http.Server
+	onShutdown    []func()
+	services      []Service
+	closed        bool
+	shutdownOnce  sync.Once
+	shutdownDelay time.Duration
+	listeners     []listener
+
+	// TLS
+	tlsConfig          *tls.Config
+	clientCAs          *x509.CertPool
+	certReload         bool
+	certReloadInterval time.Duration
+	certReloadSignal   bool
+	certWatchers       []func()
+
+	// HTTP/2
+	http2Config *HTTP2Config
+	h2c         bool
+
+	// http.Server 的超时时间
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
 }
 
 func NewHttpServer(opts ...HttpServerOption) *httpServer {
 	res := &httpServer{
-		router: newRouter(),
+		versionCfg: VersionConfig{Header: "X-API-Version"},
 		log: func(msg string, args ...any) {
 			fmt.Printf(msg, args...)
 		},
+		errorHandler: DefaultErrorHandler,
 	}
+	res.current.Store(newRouter())
 	for _, opt := range opts {
 		opt(res)
 	}
@@ -44,27 +87,68 @@ type HttpServerOption func(server *httpServer)
 // WithMiddleware 初始化server的时候可以添加中间件
 func WithMiddleware(middlewares ...Middleware) HttpServerOption {
 	return func(server *httpServer) {
-		server.middlewares = middlewares
+		server.Use(middlewares...)
+	}
+}
+
+// WithIntercepts 初始化server的时候添加拦截器，和 WithMiddleware 添加的中间件按照option的顺序执行
+func WithIntercepts(intercepts ...Intercept) HttpServerOption {
+	return func(server *httpServer) {
+		server.Use(interceptMiddlewares(intercepts)...)
+	}
+}
+
+// WithErrorHandler 设置统一的错误处理
+func WithErrorHandler(handler ErrorHandler) HttpServerOption {
+	return func(server *httpServer) {
+		server.errorHandler = handler
+	}
+}
+
+// WithShutdownDelay 开始关闭之后等待一段时间再关闭监听
+// 这段时间内就绪检查已经失败，负载均衡有时间把流量摘掉
+func WithShutdownDelay(delay time.Duration) HttpServerOption {
+	return func(server *httpServer) {
+		server.shutdownDelay = delay
 	}
 }
 
 // ServeHTTP 处理请求的入口
 func (h *httpServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.serveHTTP(writer, request, nil)
+}
+
+// serveHTTP overlay 是监听上的中间件，在server级别的中间件之后执行
+func (h *httpServer) serveHTTP(writer http.ResponseWriter, request *http.Request, overlay []Middleware) {
+	h.markServing()
+	r := h.loadRouter()
 	c := &Context{
 		Request: request,
 		Writer:  writer,
+		server:  h,
+	}
+	// 提前匹配路由，server级别的中间件也能拿到 MatchedRoute 和路径参数，例如按照路由限流和统计
+	// 没有匹配上的时候保持为空，中间件修改了method或者路径的时候 serve 会重新匹配
+	if match, ok := r.findRoute(request.Method, request.URL.Path); ok && match.hasHandler() {
+		c.match = match
+		c.matchedReq = request.Method + " " + request.URL.Path
+		c.Params = match.params
+		c.MatchedRoute = match.fullPath
 	}
 
 	// 把中间件串起来
-	cur := h.serve
-	for i := len(h.middlewares) - 1; i >= 0; i-- {
-		cur = h.middlewares[i](cur)
+	middlewares := r.middlewares
+	if len(overlay) > 0 {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], overlay...)
 	}
+	cur := buildChain(h.serve, middlewares)
 
 	// 添加最前面的flush中间件
 	var m Middleware = func(next HandleFunc) HandleFunc {
 		return func(c *Context) {
 			next(c)
+			// server级别的中间件记录的错误
+			h.handleError(c)
 			h.flushResp(c)
 		}
 	}
@@ -74,22 +158,53 @@ func (h *httpServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 
 // 路由匹配并开始执行业务逻辑
 func (h *httpServer) serve(c *Context) {
-	match, ok := h.findRoute(c.Request.Method, c.Request.URL.Path)
-	if !ok || match.handleFunc == nil {
+	match, ok := c.match, c.match != nil
+	// server级别的中间件可能修改了请求的method或者路径
+	if !ok || c.matchedReq != c.Request.Method+" "+c.Request.URL.Path {
+		match, ok = h.findRoute(c.Request.Method, c.Request.URL.Path)
+	}
+	if !ok || !match.hasHandler() {
+		// 没有注册 OPTIONS 的时候自动返回这个路径支持的method
+		if c.Request.Method == http.MethodOptions {
+			if methods := c.AllowedMethods(); len(methods) > 0 {
+				c.Writer.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+				c.RespStatusCode = http.StatusNoContent
+				return
+			}
+		}
 		c.RespStatusCode = 404
 		c.RespData = []byte("Not Found")
 		return
 	}
 
-	// 将匹配到到路由中间件串起来
-	cur := match.handleFunc
-	for i := len(match.matchedMiddlewares) - 1; i >= 0; i-- {
-		cur = match.matchedMiddlewares[i](cur)
-	}
-
 	c.Params = match.params
 	c.MatchedRoute = match.fullPath
+
+	handleFunc := match.handleFunc
+	if len(match.versions) > 0 {
+		var err error
+		handleFunc, c.APIVersion, err = h.negotiateVersion(c, match.node)
+		if err != nil {
+			c.Error(err)
+			h.handleError(c)
+			return
+		}
+	}
+
+	// 将匹配到到路由中间件串起来
+	cur := buildChain(handleFunc, match.matchedMiddlewares)
 	cur(c)
+	// 在这里处理错误，server级别的中间件就能看到最终的响应码
+	h.handleError(c)
+}
+
+// handleError 把记录的错误交给 ErrorHandler，同一个错误只处理一次
+func (h *httpServer) handleError(c *Context) {
+	if c.err == nil || c.errHandled {
+		return
+	}
+	c.errHandled = true
+	h.errorHandler(c, c.err)
 }
 
 // flushResp 最后一次性往前端发数据
@@ -102,14 +217,86 @@ func (h *httpServer) flushResp(c *Context) {
 	}
 }
 
-// Start 启动server
+// Start 启动server，调用 Shutdown 之后返回 http.ErrServerClosed
 func (h *httpServer) Start(addr string) error {
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
+	if err := h.ListenTCP(addr); err != nil {
 		return err
 	}
+	return h.Serve()
+}
+
+// Service 和server共享生命周期的服务，例如单独端口上的管理server
+// Start 会阻塞，Shutdown 之后返回 http.ErrServerClosed
+type Service interface {
+	Start() error
+	Shutdown(ctx context.Context) error
+}
+
+// Attach 添加和server一起启动、一起关闭的服务
+func (h *httpServer) Attach(svc Service) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.services = append(h.services, svc)
+}
+
+// startServices 在单独的goroutine里面启动所有服务
+func (h *httpServer) startServices() {
+	h.mu.Lock()
+	services := h.services
+	h.mu.Unlock()
+	for _, svc := range services {
+		go func(svc Service) {
+			if err := svc.Start(); err != nil && err != http.ErrServerClosed {
+				h.log("service start error: %v", err)
+			}
+		}(svc)
+	}
+}
+
+// RegisterOnShutdown 注册开始关闭的时候执行的回调，例如让就绪检查失败
+func (h *httpServer) RegisterOnShutdown(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onShutdown = append(h.onShutdown, fn)
+}
+
+// Shutdown 优雅退出：先执行回调，等待 WithShutdownDelay 设置的时间，然后不再接收新请求并等待已有请求处理完
+func (h *httpServer) Shutdown(ctx context.Context) error {
+	h.shutdownOnce.Do(func() {
+		h.mu.Lock()
+		hooks := h.onShutdown
+		h.mu.Unlock()
+		for _, hook := range hooks {
+			hook()
+		}
+	})
+
+	if h.shutdownDelay > 0 {
+		select {
+		case <-time.After(h.shutdownDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
-	return http.Serve(l, h)
+	h.mu.Lock()
+	h.closed = true
+	servers := h.servers
+	services := h.services
+	h.mu.Unlock()
+	var err error
+	for _, srv := range servers {
+		if srvErr := srv.Shutdown(ctx); srvErr != nil && err == nil {
+			err = srvErr
+		}
+	}
+	// 业务server关闭之后再关闭服务，排查退出过程中的问题的时候管理端口还能用
+	for _, svc := range services {
+		if svcErr := svc.Shutdown(ctx); svcErr != nil && err == nil {
+			err = svcErr
+		}
+	}
+	return err
 }
 
 // MatchRoute 不启动server测试路由能否匹配上
@@ -122,9 +309,22 @@ func (h *httpServer) MatchRoute(route, path string) bool {
 	return true
 }
 
-// Use 添加中间件 - 在server上直接添加中间件
+// Use 添加中间件 - 在server上直接添加中间件，运行时添加只影响之后的请求
 func (h *httpServer) Use(middlewares ...Middleware) {
-	h.middlewares = append(h.middlewares, middlewares...)
+	_ = h.updateRouter(func(r *router) error {
+		r.middlewares = append(r.middlewares[:len(r.middlewares):len(r.middlewares)], middlewares...)
+		return nil
+	})
+}
+
+// UseIntercept 在server上添加拦截器，和 Use 添加的中间件按照添加的顺序执行
+func (h *httpServer) UseIntercept(intercepts ...Intercept) {
+	h.Use(interceptMiddlewares(intercepts)...)
+}
+
+// UseInterceptWithRoute 在路由树上添加拦截器
+func (h *httpServer) UseInterceptWithRoute(method, path string, intercepts ...Intercept) {
+	h.UseWithRoute(method, path, interceptMiddlewares(intercepts)...)
 }
 
 // UseWithRoute 在路由树上添加中间件
@@ -134,40 +334,145 @@ func (h *httpServer) UseWithRoute(method, path string, middlewares ...Middleware
 	}
 }
 
+// loadRouter 当前的路由树，只读
+func (h *httpServer) loadRouter() *router {
+	return h.current.Load().(*router)
+}
+
+// updateRouter 开始处理请求之前直接修改路由树，避免注册大量路由的时候反复复制
+// 之后复制一份路由树修改再整体替换，修改过程中panic的话原来的路由树不受影响
+func (h *httpServer) updateRouter(fn func(r *router) error) error {
+	h.routerMu.Lock()
+	defer h.routerMu.Unlock()
+	r := h.loadRouter()
+	if atomic.LoadInt32(&h.serving) == 0 {
+		return fn(r)
+	}
+	r = r.clone()
+	if err := fn(r); err != nil {
+		return err
+	}
+	h.current.Store(r)
+	return nil
+}
+
+// markServing 处理第一个请求之前调用，之后对路由树的修改都要复制
+func (h *httpServer) markServing() {
+	if atomic.LoadInt32(&h.serving) == 1 {
+		return
+	}
+	h.routerMu.Lock()
+	atomic.StoreInt32(&h.serving, 1)
+	h.routerMu.Unlock()
+}
+
+func (h *httpServer) addRoute(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	_ = h.updateRouter(func(r *router) error {
+		r.addRoute(httpMethod, path, handleFunc, opts...)
+		return nil
+	})
+}
+
+func (h *httpServer) findRoute(httpMethod, path string) (*matchInfo, bool) {
+	return h.loadRouter().findRoute(httpMethod, path)
+}
+
+func (h *httpServer) routes() []routeInfo {
+	return h.loadRouter().routes()
+}
+
+func (h *httpServer) addMiddlewares(httpMethod, path string, middlewares ...Middleware) error {
+	return h.updateRouter(func(r *router) error {
+		return r.addMiddlewares(httpMethod, path, middlewares...)
+	})
+}
+
+// ReplaceRoute 运行时注册或者覆盖路由，正在处理的请求不受影响
+func (h *httpServer) ReplaceRoute(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	_ = h.updateRouter(func(r *router) error {
+		r.replaceRoute(httpMethod, path, handleFunc, opts...)
+		return nil
+	})
+}
+
+// RemoveRoute 运行时删除路由，path 必须和注册的时候一致
+func (h *httpServer) RemoveRoute(httpMethod, path string) error {
+	return h.updateRouter(func(r *router) error {
+		return r.removeRoute(httpMethod, path)
+	})
+}
+
+// ReplaceMiddlewaresWithRoute 运行时替换路由中间件，不传中间件就是删除
+func (h *httpServer) ReplaceMiddlewaresWithRoute(httpMethod, path string, middlewares ...Middleware) error {
+	return h.updateRouter(func(r *router) error {
+		return r.setMiddlewares(httpMethod, path, middlewares...)
+	})
+}
+
+// RouteInfo 已经注册的路由
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Version 通过 WithVersion 注册的版本
+	Version string `json:"version,omitempty"`
+	// Middlewares 注册在这个节点上的路由中间件
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+// Routes 所有注册的路由，按照路径和method排序
+func (h *httpServer) Routes() []RouteInfo {
+	routes := h.routes()
+	res := make([]RouteInfo, 0, len(routes))
+	for _, r := range routes {
+		res = append(res, RouteInfo{Method: r.method, Path: r.fullPath, Version: r.version, Middlewares: funcNames(r.middlewares)})
+	}
+	return res
+}
+
+// Middlewares server级别的中间件
+func (h *httpServer) Middlewares() []string {
+	return funcNames(h.loadRouter().middlewares)
+}
+
 // =======================================================================
 
-func (h *httpServer) Get(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodGet, path, handleFunc)
+// Handle 注册任意method的路由
+func (h *httpServer) Handle(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(httpMethod, path, handleFunc, opts...)
+}
+
+func (h *httpServer) Get(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodGet, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Post(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodPost, path, handleFunc)
+func (h *httpServer) Post(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodPost, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Put(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodPut, path, handleFunc)
+func (h *httpServer) Put(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodPut, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Patch(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodPatch, path, handleFunc)
+func (h *httpServer) Patch(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodPatch, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Delete(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodDelete, path, handleFunc)
+func (h *httpServer) Delete(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodDelete, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Options(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodOptions, path, handleFunc)
+func (h *httpServer) Options(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodOptions, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Head(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodHead, path, handleFunc)
+func (h *httpServer) Head(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodHead, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Trace(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodTrace, path, handleFunc)
+func (h *httpServer) Trace(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodTrace, path, handleFunc, opts...)
 }
 
-func (h *httpServer) Connect(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodConnect, path, handleFunc)
+func (h *httpServer) Connect(path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.addRoute(http.MethodConnect, path, handleFunc, opts...)
 }
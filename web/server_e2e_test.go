@@ -1,39 +1,44 @@
 package web
 
 import (
-	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestServerE2E(t *testing.T) {
+	var steps []string
 	s := NewHttpServer()
-	s.middlewares = []Middleware{
+	s.Use(
 		func(next HandleFunc) HandleFunc {
 			return func(c *Context) {
-				fmt.Println("第1个before")
+				steps = append(steps, "第1个before")
 				next(c)
-				fmt.Println("第1个after")
+				steps = append(steps, "第1个after")
 			}
 		},
 		func(next HandleFunc) HandleFunc {
 			return func(c *Context) {
-				fmt.Println("第2个before")
+				steps = append(steps, "第2个before")
 				next(c)
-				fmt.Println("第2个after")
+				steps = append(steps, "第2个after")
 			}
 		},
 		func(next HandleFunc) HandleFunc {
 			return func(c *Context) {
-				fmt.Println("第3个before")
-				fmt.Println("第3个after")
+				steps = append(steps, "第3个before")
+				steps = append(steps, "第3个after")
 			}
 		},
 		func(next HandleFunc) HandleFunc {
 			return func(c *Context) {
-				fmt.Println("第4个before")
-				fmt.Println("第4个after")
+				steps = append(steps, "第4个before")
+				steps = append(steps, "第4个after")
 			}
 		},
-	}
-	s.ServeHTTP(nil, nil)
+	)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	// 第3个没有调用next，后面的中间件不会执行
+	assert.Equal(t, []string{"第1个before", "第2个before", "第3个before", "第3个after", "第2个after", "第1个after"}, steps)
 }
@@ -1,12 +1,17 @@
 package web
 
 import (
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"regexp"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestAddRouter(t *testing.T) {
@@ -571,3 +576,224 @@ func TestRouteMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// 测试中断中间件链
+func TestServer_Abort(t *testing.T) {
+	actual := []string{}
+	var aborted bool
+
+	s := NewHttpServer(WithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			actual = append(actual, "global")
+			next(c)
+			aborted = c.IsAborted()
+		}
+	}))
+	s.Get("/user", func(c *Context) {
+		actual = append(actual, "handler")
+	})
+	s.UseWithRoute(http.MethodGet, "/user", func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			actual = append(actual, "auth")
+			c.AbortWithJSON(http.StatusUnauthorized, map[string]string{"msg": "unauthorized"})
+			// 中断之后即使调用next也不会执行后面的逻辑
+			next(c)
+		}
+	}, func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			actual = append(actual, "after auth")
+			next(c)
+		}
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/user", nil)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+
+	assert.Equal(t, []string{"global", "auth"}, actual)
+	assert.True(t, aborted)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, `{"msg":"unauthorized"}`, recorder.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+}
+
+func TestServer_PreMatch(t *testing.T) {
+	var seen []string
+	s := NewHttpServer(WithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			// server级别的中间件已经能拿到匹配结果
+			seen = append(seen, c.MatchedRoute+" "+c.PathValue("id").Val)
+			if c.Request.URL.Path == "/old/1" {
+				c.Request.URL.Path = "/order/2"
+			}
+			next(c)
+		}
+	}))
+	s.Get("/user/:id", func(c *Context) {
+		c.RespData = []byte("user " + c.PathValue("id").Val)
+	})
+	s.Get("/order/:id", func(c *Context) {
+		c.RespData = []byte(c.MatchedRoute + " " + c.PathValue("id").Val)
+	})
+	s.Get("/old/:id", func(c *Context) {
+		c.RespData = []byte("old")
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantSeen string
+		wantCode int
+		wantBody string
+	}{
+		{name: "matched", path: "/user/1", wantSeen: "/user/:id 1", wantCode: 200, wantBody: "user 1"},
+		{name: "not found", path: "/none", wantSeen: " ", wantCode: 404, wantBody: "Not Found"},
+		// 中间件修改了路径之后重新匹配
+		{name: "rewritten", path: "/old/1", wantSeen: "/old/:id 1", wantCode: 200, wantBody: "/order/:id 2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = nil
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, []string{tc.wantSeen}, seen)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+// 测试优雅退出
+func TestServer_Shutdown(t *testing.T) {
+	var hooks []string
+	s := NewHttpServer(WithShutdownDelay(10 * time.Millisecond))
+	s.RegisterOnShutdown(func() {
+		hooks = append(hooks, "readiness")
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start("127.0.0.1:0")
+	}()
+	// 等待server启动
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.servers) > 0
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+	// 回调只执行一次
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, []string{"readiness"}, hooks)
+}
+
+// 测试运行时修改路由
+func TestServer_RuntimeRoutes(t *testing.T) {
+	s := NewHttpServer()
+	s.Get("/user/:id(^[0-9]+$)", func(c *Context) {
+		c.RespData = []byte("v1")
+	})
+	s.Get("/user/:id(^[0-9]+$)/profile", func(c *Context) {})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	// 并发处理请求的同时修改路由
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = serve("/user/1")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			s.ReplaceRoute(http.MethodGet, fmt.Sprintf("/feature/%d", i), func(c *Context) {})
+			_ = s.ReplaceMiddlewaresWithRoute(http.MethodGet, "/user/1", func(next HandleFunc) HandleFunc {
+				return next
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	s.ReplaceRoute(http.MethodGet, "/user/:id(^[0-9]+$)", func(c *Context) {
+		c.RespData = []byte("v2")
+	})
+	assert.Equal(t, "v2", serve("/user/1").Body.String())
+
+	assert.NoError(t, s.ReplaceMiddlewaresWithRoute(http.MethodGet, "/user/1", func(next HandleFunc) HandleFunc {
+		return func(c *Context) {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}))
+	assert.Equal(t, http.StatusForbidden, serve("/user/1").Code)
+	assert.NoError(t, s.ReplaceMiddlewaresWithRoute(http.MethodGet, "/user/1"))
+	assert.Equal(t, http.StatusOK, serve("/user/1").Code)
+
+	assert.NoError(t, s.RemoveRoute(http.MethodGet, "/user/:id(^[0-9]+$)"))
+	assert.Equal(t, http.StatusNotFound, serve("/user/1").Code)
+	// 子路由还在
+	assert.Equal(t, http.StatusOK, serve("/user/1/profile").Code)
+	assert.Error(t, s.RemoveRoute(http.MethodGet, "/user/:id"))
+	assert.Error(t, s.RemoveRoute(http.MethodPost, "/user"))
+
+	// 删除之后空的节点被清理，可以注册冲突的通配符路由
+	assert.NoError(t, s.RemoveRoute(http.MethodGet, "/user/:id/profile"))
+	s.Get("/user/*", func(c *Context) {})
+	assert.Equal(t, http.StatusOK, serve("/user/abc").Code)
+
+	// 注册冲突panic之后原来的路由不受影响
+	assert.Panics(t, func() {
+		s.Get("/user/:name", func(c *Context) {})
+	})
+	assert.Equal(t, http.StatusOK, serve("/feature/1").Code)
+}
+
+// 开始处理请求之前直接修改路由树，之后复制再替换
+func TestServer_UpdateRouter(t *testing.T) {
+	s := NewHttpServer()
+	before := s.loadRouter()
+	for i := 0; i < 100; i++ {
+		s.Get(fmt.Sprintf("/user/%d", i), func(c *Context) {})
+	}
+	s.Use(func(next HandleFunc) HandleFunc { return next })
+	assert.Same(t, before, s.loadRouter())
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	s.Get("/order", func(c *Context) {})
+	after := s.loadRouter()
+	assert.NotSame(t, before, after)
+	_, ok := before.findRoute(http.MethodGet, "/order")
+	assert.False(t, ok)
+
+	// 运行时添加中间件和处理请求并发
+	var hits int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/1", nil))
+		}()
+		go func() {
+			defer wg.Done()
+			s.Use(func(next HandleFunc) HandleFunc {
+				return func(c *Context) {
+					atomic.AddInt32(&hits, 1)
+					next(c)
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, after.middlewares, 1)
+	assert.Len(t, s.Middlewares(), 11)
+	atomic.StoreInt32(&hits, 0)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	assert.Equal(t, int32(10), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,31 @@
+package web
+
+import "time"
+
+// WithReadTimeout 读取整个请求的超时时间，包括请求体
+func WithReadTimeout(timeout time.Duration) HttpServerOption {
+	return func(server *httpServer) {
+		server.readTimeout = timeout
+	}
+}
+
+// WithReadHeaderTimeout 读取请求头的超时时间
+func WithReadHeaderTimeout(timeout time.Duration) HttpServerOption {
+	return func(server *httpServer) {
+		server.readHeaderTimeout = timeout
+	}
+}
+
+// WithWriteTimeout 从读完请求头到写完响应的超时时间
+func WithWriteTimeout(timeout time.Duration) HttpServerOption {
+	return func(server *httpServer) {
+		server.writeTimeout = timeout
+	}
+}
+
+// WithIdleTimeout keep-alive 连接空闲多久之后关闭，HTTP/2没有单独设置的时候也使用它
+func WithIdleTimeout(timeout time.Duration) HttpServerOption {
+	return func(server *httpServer) {
+		server.idleTimeout = timeout
+	}
+}
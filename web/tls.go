@@ -0,0 +1,271 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WithTLSConfig StartTLS 使用的基础配置，证书由 StartTLS 的参数提供
+func WithTLSConfig(cfg *tls.Config) HttpServerOption {
+	return func(server *httpServer) {
+		server.tlsConfig = cfg
+	}
+}
+
+// WithClientCAs 开启双向TLS，客户端证书必须由 pool 里面的CA签发
+// 没有通过 WithTLSConfig 指定 ClientAuth 的时候使用 tls.RequireAndVerifyClientCert
+func WithClientCAs(pool *x509.CertPool) HttpServerOption {
+	return func(server *httpServer) {
+		server.clientCAs = pool
+	}
+}
+
+// WithCertReload 证书文件修改之后自动重新加载，interval 是检查修改时间的间隔
+// 已经建立的连接不受影响
+func WithCertReload(interval time.Duration) HttpServerOption {
+	return func(server *httpServer) {
+		server.certReloadInterval = interval
+		server.certReload = true
+	}
+}
+
+// WithCertReloadOnSIGHUP 收到 SIGHUP 的时候重新加载证书，可以和 WithCertReload 一起使用
+// 证书检查运行期间 SIGHUP 不会再让进程退出，Serve 返回或者 Shutdown 之后恢复
+func WithCertReloadOnSIGHUP() HttpServerOption {
+	return func(server *httpServer) {
+		server.certReloadSignal = true
+		server.certReload = true
+	}
+}
+
+// LoadCertPool 从PEM文件加载CA证书
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("web: no certificate found in '%s'", file)
+		}
+	}
+	return pool, nil
+}
+
+// StartTLS 以HTTPS的方式启动，证书通过 GetCertificate 提供，所以可以在运行的时候替换
+func (h *httpServer) StartTLS(addr, certFile, keyFile string) error {
+	cfg, stop, err := h.newTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	if h.isServing() {
+		stop()
+		return errServing
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		stop()
+		return err
+	}
+	h.Listen(tls.NewListener(l, cfg))
+	return h.serveListeners(stop)
+}
+
+// ServeTLS 和 Serve 一样，但是所有已经添加的监听都使用TLS
+// 可以和 ListenTCP、ListenUnix、ListenSystemd 一起使用，只有部分监听需要TLS的时候使用 TLSConfig
+func (h *httpServer) ServeTLS(certFile, keyFile string) error {
+	cfg, stop, err := h.newTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	if len(h.servers) > 0 {
+		h.mu.Unlock()
+		stop()
+		return errServing
+	}
+	for i, l := range h.listeners {
+		h.listeners[i].Listener = tls.NewListener(l.Listener, cfg)
+	}
+	h.mu.Unlock()
+	return h.serveListeners(stop)
+}
+
+// TLSConfig 按照 WithTLSConfig、WithClientCAs、WithCertReload 生成配置，例如 h.Listen(tls.NewListener(l, cfg))
+// 开启 WithCertReload 的时候在后台检查证书，Serve 返回或者 Shutdown 的时候停止
+func (h *httpServer) TLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cfg, stop, err := h.newTLSConfig(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	h.certWatchers = append(h.certWatchers, stop)
+	h.mu.Unlock()
+	return cfg, nil
+}
+
+// newTLSConfig 返回的 stop 停止证书检查，可以重复调用，Shutdown 的时候也会调用
+func (h *httpServer) newTLSConfig(certFile, keyFile string) (*tls.Config, func(), error) {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := func() {}
+	if h.certReload && (h.certReloadInterval > 0 || h.certReloadSignal) {
+		var sighup chan os.Signal
+		if h.certReloadSignal {
+			// 在启动goroutine之前注册，返回之后收到的 SIGHUP 都不会让进程退出
+			sighup = make(chan os.Signal, 1)
+			signal.Notify(sighup, syscall.SIGHUP)
+		}
+		ch, done := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(done)
+			reloader.watch(h.certReloadInterval, sighup, ch, h.log)
+		}()
+		var once sync.Once
+		// 等检查的goroutine退出之后再恢复 SIGHUP 的默认行为
+		stop = func() {
+			once.Do(func() {
+				close(ch)
+				<-done
+				if sighup != nil {
+					signal.Stop(sighup)
+				}
+			})
+		}
+		h.RegisterOnShutdown(stop)
+	}
+	return h.buildTLSConfig(reloader), stop, nil
+}
+
+// stopCertWatchers 停止 TLSConfig 启动的证书检查
+func (h *httpServer) stopCertWatchers() {
+	h.mu.Lock()
+	watchers := h.certWatchers
+	h.certWatchers = nil
+	h.mu.Unlock()
+	for _, stop := range watchers {
+		stop()
+	}
+}
+
+func (h *httpServer) buildTLSConfig(reloader *certReloader) *tls.Config {
+	cfg := &tls.Config{}
+	if h.tlsConfig != nil {
+		cfg = h.tlsConfig.Clone()
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+	cfg.Certificates = nil
+	cfg.GetCertificate = reloader.GetCertificate
+	if h.clientCAs != nil {
+		cfg.ClientCAs = h.clientCAs
+		if cfg.ClientAuth == tls.NoClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg
+}
+
+// certReloader 持有当前的证书，文件变化之后替换
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload 加载失败的时候继续使用之前的证书
+func (r *certReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// changed 证书或者私钥的修改时间是否变化了
+func (r *certReloader) changed() bool {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime.Equal(r.modTime)
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch interval 为0的时候只响应 SIGHUP，sighup 为nil的时候只检查修改时间
+func (r *certReloader) watch(interval time.Duration, sighup <-chan os.Signal, stop <-chan struct{}, log func(msg string, args ...any)) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-sighup:
+		case <-tick:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.reload(); err != nil {
+			log("web: reload certificate failed: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert parent 为nil的时候生成自签名的CA
+func newTestCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestServer_StartTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0600))
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server-1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	client := newTestCert(t, "order-service", ca, x509.ExtKeyUsageClientAuth)
+
+	pool, err := LoadCertPool(caFile)
+	require.NoError(t, err)
+	s := NewHttpServer(WithClientCAs(pool), WithCertReload(10*time.Millisecond))
+	s.Get("/whoami", func(c *Context) {
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte(c.PeerCertificate().Subject.CommonName)
+	})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.StartTLS("127.0.0.1:0", certFile, keyFile)
+	}()
+	require.Eventually(t, func() bool {
+		return len(s.Addrs()) > 0
+	}, time.Second, time.Millisecond)
+	url := "https://" + s.Addrs()[0].String() + "/whoami"
+
+	get := func(certs ...tls.Certificate) (*http.Response, string, error) {
+		cli := &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+		resp, err := cli.Get(url)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, string(body), err
+	}
+	clientCert := tls.Certificate{Certificate: [][]byte{client.der}, PrivateKey: client.key}
+
+	resp, body, err := get(clientCert)
+	require.NoError(t, err)
+	assert.Equal(t, "order-service", body)
+	assert.Equal(t, "server-1", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// 没有客户端证书
+	_, _, err = get()
+	assert.Error(t, err)
+
+	// 替换证书之后新的连接使用新证书
+	newTestCert(t, "server-2", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	assert.Eventually(t, func() bool {
+		resp, _, err := get(clientCert)
+		return err == nil && resp.TLS.PeerCertificates[0].Subject.CommonName == "server-2"
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+}
+
+func TestServer_ServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server-1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	// Unix域套接字上使用TLS
+	s := NewHttpServer(WithCertReload(10 * time.Millisecond))
+	s.Get("/ping", func(c *Context) {
+		c.RespStatusCode = http.StatusOK
+		c.RespData = []byte("pong")
+	})
+	sock := filepath.Join(dir, "web.sock")
+	require.NoError(t, s.ListenUnix(sock, 0))
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ServeTLS(certFile, keyFile)
+	}()
+	cli := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = cli.Get("https://web/ping")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "pong", string(body))
+	assert.Equal(t, "server-1", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// 已经在处理请求
+	assert.Error(t, s.ServeTLS(certFile, keyFile))
+	assert.Error(t, s.StartTLS("127.0.0.1:0", certFile, keyFile))
+	assert.Len(t, s.Addrs(), 1)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+}
+
+func TestServer_TLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server-1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+
+	s := NewHttpServer(WithCertReload(time.Hour))
+	_, err := s.TLSConfig(filepath.Join(dir, "missing.pem"), keyFile)
+	assert.Error(t, err)
+	cfg, err := s.TLSConfig(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.Len(t, s.certWatchers, 1)
+
+	// Serve 出错返回的时候停止证书检查
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	s.Listen(tls.NewListener(l, cfg))
+	err = s.Serve()
+	assert.Error(t, err)
+	assert.NotEqual(t, http.ErrServerClosed, err)
+	assert.Empty(t, s.certWatchers)
+}
+
+func TestServer_CertReloadOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server-1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+
+	s := NewHttpServer(WithCertReloadOnSIGHUP())
+	cfg, err := s.TLSConfig(certFile, keyFile)
+	require.NoError(t, err)
+	defer s.stopCertWatchers()
+
+	// 没有 WithCertReload 的时候不会检查修改时间，只响应 SIGHUP
+	newTestCert(t, "server-2", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	proc, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, proc.Signal(syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		cert, err := cfg.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName == "server-2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	_, err := newCertReloader(certFile, keyFile)
+	assert.Error(t, err)
+
+	ca := newTestCert(t, "ca", nil, 0)
+	newTestCert(t, "server-1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.False(t, r.changed())
+
+	// 加载失败继续使用之前的证书
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	assert.True(t, r.changed())
+	assert.Error(t, r.reload())
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, "server-1", leaf.Subject.CommonName)
+}
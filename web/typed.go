@@ -0,0 +1,82 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Routable 可以注册路由的对象，server 和 Group 都实现了
+type Routable interface {
+	Handle(httpMethod, path string, handleFunc HandleFunc, opts ...RouteOption)
+}
+
+// HandleTyped 用 Typed 注册路由，Req 和 Resp 会自动出现在 OpenAPI 文档里面
+func HandleTyped[Req, Resp any](r Routable, httpMethod, path string, fn func(ctx context.Context, req Req) (Resp, error), opts ...RouteOption) {
+	r.Handle(httpMethod, path, Typed(fn), append([]RouteOption{WithTypes[Req, Resp]()}, opts...)...)
+}
+
+// Typed 把不依赖 Context 的业务函数转换成 HandleFunc
+// 通过 HandleTyped 注册的时候不需要再用 WithTypes 声明文档里的类型
+// Req 的标签在这里检查，未知的校验规则或者不支持的字段类型直接 panic
+// 请求会通过 Bind 绑定到 Req 上，请求格式不对或者校验失败返回400
+// 业务函数返回的 Resp 以JSON返回，error交给server的 ErrorHandler 处理
+func Typed[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) HandleFunc {
+	typ := reflect.TypeOf((*Req)(nil)).Elem()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("web: typed request must be a struct, got %s", typ))
+	}
+	if err := checkTags(typ); err != nil {
+		panic(fmt.Sprintf("web: typed request %s: %v", typ, err))
+	}
+	return func(c *Context) {
+		req, err := bindTyped[Req](c)
+		if err != nil {
+			c.Error(bindHTTPError(c, err))
+			return
+		}
+		resp, err := fn(c.Request.Context(), req)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// bindHTTPError 只有请求本身的问题返回400，原始的错误信息只用来记录，不返回给客户端
+func bindHTTPError(c *Context, err error) *HTTPError {
+	var ve ValidationErrors
+	var be *bindError
+	var te *tagError
+	switch {
+	case errors.As(err, &ve):
+		return NewHTTPError(http.StatusBadRequest, ve.Localize(c.Translator())).Wrap(err)
+	case errors.As(err, &be):
+		return NewHTTPError(http.StatusBadRequest, be.msg).Wrap(err)
+	case errors.As(err, &te):
+		return NewHTTPError(http.StatusInternalServerError, "").Wrap(err)
+	}
+	// Validator 返回的错误
+	return NewHTTPError(http.StatusBadRequest, err.Error()).Wrap(err)
+}
+
+// bindTyped Req 可以是结构体也可以是结构体指针
+func bindTyped[Req any](c *Context) (Req, error) {
+	var req Req
+	typ := reflect.TypeOf(&req).Elem()
+	if typ.Kind() == reflect.Pointer {
+		val := reflect.New(typ.Elem())
+		if err := c.Bind(val.Interface()); err != nil {
+			return req, err
+		}
+		return val.Interface().(Req), nil
+	}
+	err := c.Bind(&req)
+	return req, err
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type getUserReq struct {
+	ID int64 `path:"id" validate:"min=1"`
+}
+
+type userResp struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func getUser(ctx context.Context, req *getUserReq) (userResp, error) {
+	if req.ID == 404 {
+		return userResp{}, NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	return userResp{ID: req.ID, Name: "ppp"}, nil
+}
+
+func TestTyped(t *testing.T) {
+	// 业务函数可以直接单元测试
+	resp, err := getUser(context.Background(), &getUserReq{ID: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "ppp", resp.Name)
+
+	s := NewHttpServer()
+	s.Get("/user/:id", Typed(getUser))
+	s.Post("/user", Typed(func(ctx context.Context, req userResp) (userResp, error) {
+		return req, nil
+	}))
+
+	testcase := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "ok", method: http.MethodGet, path: "/user/1", wantCode: 200, wantBody: `{"id":1,"name":"ppp"}`},
+		{name: "business error", method: http.MethodGet, path: "/user/404", wantCode: 404, wantBody: `{"code":404,"message":"user not found"}`},
+		{name: "bind error", method: http.MethodGet, path: "/user/abc", wantCode: 400, wantBody: `{"code":400,"message":"invalid value for 'id'"}`},
+		// 不把JSON解析的原始错误返回给客户端
+		{name: "invalid body", method: http.MethodPost, path: "/user", body: `{"id":"x"}`, wantCode: 400, wantBody: `{"code":400,"message":"invalid request body"}`},
+		{name: "validate error", method: http.MethodGet, path: "/user/0", wantCode: 400, wantBody: `{"code":400,"message":"field 'ID' failed on 'min=1'"}`},
+		{name: "body", method: http.MethodPost, path: "/user", body: `{"id":2,"name":"abc"}`, wantCode: 200, wantBody: `{"id":2,"name":"abc"}`},
+	}
+	for _, tt := range testcase {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Accept", "application/json")
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, request)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestTyped_InvalidTags(t *testing.T) {
+	type unknownRule struct {
+		Name string `validate:"email"`
+	}
+	type unsupportedRule struct {
+		Meta struct{} `validate:"min=1"`
+	}
+	type unsupportedBind struct {
+		Meta *struct{} `query:"meta"`
+	}
+	type validPointer struct {
+		Age  *int     `query:"age" validate:"min=18"`
+		Tags []string `query:"tag" validate:"max=3"`
+	}
+	// 标签写错了是代码的问题，注册的时候就 panic，而不是每个请求返回400
+	assert.Panics(t, func() {
+		Typed(func(ctx context.Context, req unknownRule) (struct{}, error) { return struct{}{}, nil })
+	})
+	assert.Panics(t, func() {
+		Typed(func(ctx context.Context, req *unsupportedRule) (struct{}, error) { return struct{}{}, nil })
+	})
+	assert.Panics(t, func() {
+		Typed(func(ctx context.Context, req unsupportedBind) (struct{}, error) { return struct{}{}, nil })
+	})
+	assert.Panics(t, func() {
+		Typed(func(ctx context.Context, req string) (struct{}, error) { return struct{}{}, nil })
+	})
+	assert.NotPanics(t, func() {
+		Typed(func(ctx context.Context, req validPointer) (struct{}, error) { return struct{}{}, nil })
+	})
+}
+
+func TestBindHTTPError(t *testing.T) {
+	c := &Context{}
+	// 直接调用 Bind 的时候标签的错误只能在运行时发现，返回500并且不带原始信息
+	err := bindHTTPError(c, &tagError{msg: "web: unknown validate rule 'email'"})
+	assert.Equal(t, http.StatusInternalServerError, err.Code)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), err.Message)
+	err = bindHTTPError(c, errors.New("not admin"))
+	assert.Equal(t, http.StatusBadRequest, err.Code)
+	assert.Equal(t, "not admin", err.Message)
+}
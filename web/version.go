@@ -0,0 +1,197 @@
+package web
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionConfig 通过请求头区分API版本
+// - Accept: application/vnd.<Vendor>.v2+json 或者 application/vnd.<Vendor>.v2.1+json，不支持的版本返回406
+// - <Header>: 2，不支持的版本返回400
+// 两者都有的时候以 Header 为准
+type VersionConfig struct {
+	// Vendor 为空的时候接受任意 vendor
+	Vendor string
+	// Header 默认是 X-API-Version
+	Header string
+	// Default 请求没有指定版本的时候使用的版本
+	Default string
+}
+
+// WithAPIVersioning 开启基于请求头的版本路由
+func WithAPIVersioning(cfg VersionConfig) HttpServerOption {
+	return func(server *httpServer) {
+		if cfg.Header == "" {
+			cfg.Header = "X-API-Version"
+		}
+		cfg.Default = normalizeVersion(cfg.Default)
+		server.versionCfg = cfg
+	}
+}
+
+// WithVersion 声明路由的版本，同一个路径可以注册多个版本
+// 没有声明版本的路由只处理没有指定版本的请求
+func WithVersion(version string) RouteOption {
+	return func(m *routeMeta) {
+		m.version = normalizeVersion(version)
+	}
+}
+
+// 同一个节点上不同版本的业务逻辑
+type versionedRoute struct {
+	handleFunc HandleFunc
+	meta       *routeMeta
+}
+
+func (n *node) hasHandler() bool {
+	return n.handleFunc != nil || len(n.versions) > 0
+}
+
+// setHandler 设置节点上的业务逻辑，replace 为false的时候重复注册会panic
+func (n *node) setHandler(path string, handleFunc HandleFunc, meta *routeMeta, replace bool) {
+	if meta.version == "" {
+		if n.handleFunc != nil && !replace {
+			panic(fmt.Sprintf("'%s' conflict with existed path", path))
+		}
+		n.handleFunc = handleFunc
+		n.meta = meta
+		return
+	}
+	if _, ok := n.versions[meta.version]; ok && !replace {
+		panic(fmt.Sprintf("'%s' version '%s' conflict with existed path", path, meta.version))
+	}
+	if n.versions == nil {
+		n.versions = map[string]*versionedRoute{}
+	}
+	n.versions[meta.version] = &versionedRoute{handleFunc: handleFunc, meta: meta}
+}
+
+func (n *node) clearHandler() {
+	n.handleFunc = nil
+	n.meta = nil
+	n.versions = nil
+}
+
+// sortedVersions 节点上注册的所有版本，按照版本号从小到大排序
+func (n *node) sortedVersions() []string {
+	res := make([]string, 0, len(n.versions))
+	for v := range n.versions {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return compareVersions(res[i], res[j]) < 0
+	})
+	return res
+}
+
+// compareVersions 按照 . 分隔的每一段比较，数字按照大小比较，例如 2 < 10 < 10.1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// negotiateVersion 根据请求头选择业务逻辑，返回选中的版本
+func (h *httpServer) negotiateVersion(c *Context, n *node) (HandleFunc, string, error) {
+	requested, fromAccept := h.requestedVersion(c.Request)
+	version := requested
+	if version == "" {
+		version = h.versionCfg.Default
+	}
+	if vr, ok := n.versions[version]; ok && version != "" {
+		return vr.handleFunc, version, nil
+	}
+	// 请求没有指定版本的时候，没有声明版本的路由兜底
+	if requested == "" && n.handleFunc != nil {
+		return n.handleFunc, "", nil
+	}
+	if version == "" {
+		return nil, "", NewHTTPError(http.StatusBadRequest, "API version required")
+	}
+	msg := fmt.Sprintf("unsupported API version '%s'", version)
+	if fromAccept {
+		return nil, "", NewHTTPError(http.StatusNotAcceptable, msg)
+	}
+	return nil, "", NewHTTPError(http.StatusBadRequest, msg)
+}
+
+// requestedVersion 返回请求的版本，以及是不是从Accept里面解析出来的
+func (h *httpServer) requestedVersion(r *http.Request) (string, bool) {
+	if v := r.Header.Get(h.versionCfg.Header); v != "" {
+		return normalizeVersion(v), false
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || !strings.HasPrefix(mediaType, "application/vnd.") {
+				continue
+			}
+			// application/vnd.ourapp.v2+json
+			sub := strings.TrimPrefix(mediaType, "application/vnd.")
+			sub, _, _ = strings.Cut(sub, "+")
+			vendor, version, ok := parseVendorVersion(sub)
+			if !ok {
+				continue
+			}
+			if h.versionCfg.Vendor != "" && vendor != h.versionCfg.Vendor {
+				continue
+			}
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// parseVendorVersion 解析 <vendor>.v<major>[.<minor>]，vendor 里面也可以有 .
+// 例如 ourapp.v2.1 返回 ourapp 和 2.1，my.app.v3 返回 my.app 和 3
+func parseVendorVersion(sub string) (string, string, bool) {
+	segs := strings.Split(sub, ".")
+	for i := 1; i < len(segs); i++ {
+		if !strings.HasPrefix(segs[i], "v") || !isDigits(segs[i][1:]) {
+			continue
+		}
+		// v 后面的每一段都必须是数字，否则还是 vendor 的一部分
+		version := append([]string{segs[i][1:]}, segs[i+1:]...)
+		valid := true
+		for _, seg := range version[1:] {
+			valid = valid && isDigits(seg)
+		}
+		if valid {
+			return strings.Join(segs[:i], "."), strings.Join(version, "."), true
+		}
+	}
+	return "", "", false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeVersion v2 和 2 是同一个版本
+func normalizeVersion(version string) string {
+	return strings.TrimPrefix(strings.TrimSpace(version), "v")
+}
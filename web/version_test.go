@@ -0,0 +1,165 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "2", b: "10", want: -1},
+		{a: "10", b: "2", want: 1},
+		{a: "1.2", b: "1.10", want: -1},
+		{a: "1", b: "1.1", want: -1},
+		{a: "2", b: "2", want: 0},
+		{a: "beta", b: "alpha", want: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			res := compareVersions(tc.a, tc.b)
+			switch {
+			case tc.want < 0:
+				assert.Negative(t, res)
+			case tc.want > 0:
+				assert.Positive(t, res)
+			default:
+				assert.Zero(t, res)
+			}
+		})
+	}
+}
+
+func TestParseVendorVersion(t *testing.T) {
+	testCases := []struct {
+		sub         string
+		wantVendor  string
+		wantVersion string
+		wantOK      bool
+	}{
+		{sub: "ourapp.v2", wantVendor: "ourapp", wantVersion: "2", wantOK: true},
+		{sub: "ourapp.v2.1", wantVendor: "ourapp", wantVersion: "2.1", wantOK: true},
+		{sub: "my.app.v3", wantVendor: "my.app", wantVersion: "3", wantOK: true},
+		{sub: "vendor.v1.api.v2", wantVendor: "vendor.v1.api", wantVersion: "2", wantOK: true},
+		{sub: "ourapp", wantOK: false},
+		{sub: "v2", wantOK: false},
+		{sub: "ourapp.vbeta", wantOK: false},
+		{sub: "ourapp.v2.x", wantOK: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sub, func(t *testing.T) {
+			vendor, version, ok := parseVendorVersion(tc.sub)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantVendor, vendor)
+			assert.Equal(t, tc.wantVersion, version)
+		})
+	}
+}
+
+func TestAPIVersioning(t *testing.T) {
+	s := NewHttpServer(WithAPIVersioning(VersionConfig{Vendor: "ourapp", Default: "v1"}))
+	handler := func(name string) HandleFunc {
+		return func(c *Context) {
+			c.RespStatusCode = http.StatusOK
+			c.RespData = []byte(name + ":" + c.APIVersion)
+		}
+	}
+	s.Get("/user", handler("user-v1"), WithVersion("v1"))
+	s.Get("/user", handler("user-v2"), WithVersion("2"))
+	s.Get("/order", handler("order-v2"), WithVersion("v2"))
+	s.Get("/order", handler("order-v2.1"), WithVersion("v2.1"))
+	s.Get("/order", handler("order-v10"), WithVersion("v10"), WithSummary("order v10"))
+	s.Get("/item", handler("item-any"), WithSummary("item any"))
+	s.Get("/item", handler("item-v3"), WithVersion("v3"))
+	s.Get("/item", handler("item-v10"), WithVersion("v10"), WithSummary("item v10"))
+
+	testCases := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{name: "default", path: "/user", wantCode: 200, wantBody: "user-v1:1"},
+		{name: "header", path: "/user", headers: map[string]string{"X-API-Version": "v2"}, wantCode: 200, wantBody: "user-v2:2"},
+		{name: "accept", path: "/user", headers: map[string]string{"Accept": "text/html, application/vnd.ourapp.v2+json"}, wantCode: 200, wantBody: "user-v2:2"},
+		{name: "header over accept", path: "/user", headers: map[string]string{"X-API-Version": "1", "Accept": "application/vnd.ourapp.v2+json"}, wantCode: 200, wantBody: "user-v1:1"},
+		{name: "other vendor", path: "/user", headers: map[string]string{"Accept": "application/vnd.other.v2+json"}, wantCode: 200, wantBody: "user-v1:1"},
+		{name: "unsupported header", path: "/user", headers: map[string]string{"X-API-Version": "9"}, wantCode: 400},
+		{name: "unsupported accept", path: "/user", headers: map[string]string{"Accept": "application/vnd.ourapp.v9+json"}, wantCode: 406},
+		{name: "default not registered", path: "/order", wantCode: 406, headers: map[string]string{"Accept": "application/vnd.ourapp.v1+json"}},
+		{name: "default missing", path: "/order", wantCode: 400},
+		{name: "dotted accept", path: "/order", headers: map[string]string{"Accept": "application/vnd.ourapp.v2.1+json"}, wantCode: 200, wantBody: "order-v2.1:2.1"},
+		{name: "dotted header", path: "/order", headers: map[string]string{"X-API-Version": "v2.1"}, wantCode: 200, wantBody: "order-v2.1:2.1"},
+		{name: "unversioned fallback", path: "/item", wantCode: 200, wantBody: "item-any:"},
+		{name: "no fallback for unsupported header", path: "/item", headers: map[string]string{"X-API-Version": "9"}, wantCode: 400},
+		{name: "no fallback for unsupported accept", path: "/item", headers: map[string]string{"Accept": "application/vnd.ourapp.v9+json"}, wantCode: 406},
+		{name: "versioned", path: "/item", headers: map[string]string{"X-API-Version": "3"}, wantCode: 200, wantBody: "item-v3:3"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+		})
+	}
+
+	assert.Panics(t, func() {
+		s.Get("/user", handler("dup"), WithVersion("v2"))
+	})
+
+	var versions []string
+	for _, r := range s.Routes() {
+		if r.Path == "/user" {
+			versions = append(versions, r.Version)
+		}
+	}
+	assert.Equal(t, []string{"1", "2"}, versions)
+	versions = nil
+	for _, r := range s.Routes() {
+		if r.Path == "/item" {
+			versions = append(versions, r.Version)
+		}
+	}
+	// 按照版本号排序，10 在 3 后面
+	assert.Equal(t, []string{"", "3", "10"}, versions)
+
+	doc := s.OpenAPI(OpenAPIInfo{Title: "test"})
+	params := doc.Paths["/user"]["get"].Parameters
+	assert.Equal(t, "X-API-Version", params[len(params)-1].Name)
+	assert.Equal(t, []string{"1", "2"}, params[len(params)-1].Schema.Enum)
+	assert.False(t, params[len(params)-1].Required)
+	// 没有默认版本，也没有兜底的路由，文档是最新的版本
+	op := doc.Paths["/order"]["get"]
+	assert.Equal(t, "order v10", op.Summary)
+	assert.Equal(t, []string{"2", "2.1", "10"}, op.Parameters[len(op.Parameters)-1].Schema.Enum)
+	assert.True(t, op.Parameters[len(op.Parameters)-1].Required)
+	// 不指定版本的请求交给兜底的路由
+	op = doc.Paths["/item"]["get"]
+	assert.Equal(t, "item any", op.Summary)
+	assert.Equal(t, []string{"", "3", "10"}, op.Parameters[len(op.Parameters)-1].Schema.Enum)
+	assert.False(t, op.Parameters[len(op.Parameters)-1].Required)
+
+	s.ReplaceRoute(http.MethodGet, "/user", handler("user-v2-new"), WithVersion("v2"))
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("X-API-Version", "2")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, "user-v2-new:2", recorder.Body.String())
+
+	assert.NoError(t, s.RemoveRoute(http.MethodGet, "/user"))
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
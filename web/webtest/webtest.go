@@ -0,0 +1,332 @@
+package webtest
+
+import (
+	"WebFramework/web"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 请求默认发往这个地址，只是为了构造请求和管理cookie，不会真的监听端口
+const baseURL = "http://example.com"
+
+// Server 可以被测试的server，web.NewHttpServer 返回的server满足这个接口
+type Server interface {
+	web.Server
+	Use(middlewares ...web.Middleware)
+}
+
+// Client 直接调用 ServeHTTP 的测试客户端，不需要启动server
+// 多次请求之间会保存响应设置的cookie
+type Client struct {
+	t       testing.TB
+	handler http.Handler
+	jar     http.CookieJar
+}
+
+// ctxHolderKey 每个请求带上自己的 ctxHolder，并发的请求不会互相覆盖
+type ctxHolderKey struct{}
+
+type ctxHolder struct {
+	ctx *web.Context
+}
+
+// New 会在server上添加一个记录 Context 的中间件，所以要在添加其它中间件之后调用
+func New(t testing.TB, s Server) *Client {
+	jar, _ := cookiejar.New(nil)
+	c := &Client{t: t, handler: s, jar: jar}
+	s.Use(func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			// 不是通过 Client 发出的请求没有 ctxHolder
+			if holder, ok := ctx.Request.Context().Value(ctxHolderKey{}).(*ctxHolder); ok {
+				holder.ctx = ctx
+			}
+			next(ctx)
+		}
+	})
+	return c
+}
+
+func (c *Client) Get(path string) *Request {
+	return c.Request(http.MethodGet, path)
+}
+
+func (c *Client) Post(path string) *Request {
+	return c.Request(http.MethodPost, path)
+}
+
+func (c *Client) Put(path string) *Request {
+	return c.Request(http.MethodPut, path)
+}
+
+func (c *Client) Patch(path string) *Request {
+	return c.Request(http.MethodPatch, path)
+}
+
+func (c *Client) Delete(path string) *Request {
+	return c.Request(http.MethodDelete, path)
+}
+
+func (c *Client) Options(path string) *Request {
+	return c.Request(http.MethodOptions, path)
+}
+
+func (c *Client) Head(path string) *Request {
+	return c.Request(http.MethodHead, path)
+}
+
+func (c *Client) Request(method, path string) *Request {
+	return &Request{
+		client: c,
+		method: method,
+		path:   path,
+		header: http.Header{},
+		query:  url.Values{},
+	}
+}
+
+// Request 构造请求
+type Request struct {
+	client  *Client
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	body    []byte
+	cookies []*http.Cookie
+}
+
+func (r *Request) WithHeader(key, val string) *Request {
+	r.header.Add(key, val)
+	return r
+}
+
+func (r *Request) WithQuery(key, val string) *Request {
+	r.query.Add(key, val)
+	return r
+}
+
+func (r *Request) WithCookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// WithJSON 请求体序列化成JSON
+func (r *Request) WithJSON(val any) *Request {
+	data, err := json.Marshal(val)
+	if err != nil {
+		r.client.t.Fatalf("webtest: marshal json: %v", err)
+	}
+	r.header.Set("Content-Type", "application/json")
+	r.body = data
+	return r
+}
+
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+// Expect 发送请求
+func (r *Request) Expect() *Response {
+	t := r.client.t
+	t.Helper()
+
+	target := baseURL + r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(r.path, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	request := httptest.NewRequest(r.method, target, body)
+	for key, vals := range r.header {
+		request.Header[key] = vals
+	}
+	for _, cookie := range r.client.jar.Cookies(request.URL) {
+		request.AddCookie(cookie)
+	}
+	for _, cookie := range r.cookies {
+		request.AddCookie(cookie)
+	}
+
+	holder := &ctxHolder{}
+	request = request.WithContext(context.WithValue(request.Context(), ctxHolderKey{}, holder))
+	recorder := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(recorder, request)
+	r.client.jar.SetCookies(request.URL, recorder.Result().Cookies())
+
+	return &Response{t: t, recorder: recorder, ctx: holder.ctx}
+}
+
+// Response 对响应做断言，断言失败会标记测试失败并继续执行
+type Response struct {
+	t        testing.TB
+	recorder *httptest.ResponseRecorder
+	ctx      *web.Context
+}
+
+// Raw 原始的响应
+func (r *Response) Raw() *httptest.ResponseRecorder {
+	return r.recorder
+}
+
+// Context 处理这次请求的 Context，可以用来检查中间件写入的数据
+func (r *Response) Context() *web.Context {
+	return r.ctx
+}
+
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, code, r.recorder.Code, "status code")
+	return r
+}
+
+func (r *Response) Header(key, val string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, val, r.recorder.Header().Get(key), "header %s", key)
+	return r
+}
+
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, body, r.recorder.Body.String(), "body")
+	return r
+}
+
+func (r *Response) BodyContains(sub string) *Response {
+	r.t.Helper()
+	assert.Contains(r.t, r.recorder.Body.String(), sub, "body")
+	return r
+}
+
+// JSON 响应体和 val 序列化之后的JSON相等
+func (r *Response) JSON(val any) *Response {
+	r.t.Helper()
+	want, err := json.Marshal(val)
+	if err != nil {
+		r.t.Fatalf("webtest: marshal json: %v", err)
+	}
+	assert.JSONEq(r.t, string(want), r.recorder.Body.String(), "json body")
+	return r
+}
+
+// JSONPath 断言响应体中某个路径的值，例如 $.user.name、$.items[0].id
+func (r *Response) JSONPath(path string, want any) *Response {
+	r.t.Helper()
+	var body any
+	if err := json.Unmarshal(r.recorder.Body.Bytes(), &body); err != nil {
+		r.t.Errorf("webtest: body is not json: %v", err)
+		return r
+	}
+	actual, err := lookup(body, path)
+	if err != nil {
+		r.t.Errorf("webtest: %v", err)
+		return r
+	}
+	// 统一经过一次JSON转换，避免数字类型不一致
+	data, _ := json.Marshal(want)
+	var normalized any
+	_ = json.Unmarshal(data, &normalized)
+	assert.Equal(r.t, normalized, actual, "json path %s", path)
+	return r
+}
+
+// Route 断言匹配到的路由
+func (r *Response) Route(pattern string) *Response {
+	r.t.Helper()
+	if r.ctx == nil {
+		r.t.Errorf("webtest: request did not reach the server middleware chain")
+		return r
+	}
+	assert.Equal(r.t, pattern, r.ctx.MatchedRoute, "matched route")
+	return r
+}
+
+// Value 断言 Context 存储里面的数据
+func (r *Response) Value(key string, want any) *Response {
+	r.t.Helper()
+	if r.ctx == nil {
+		r.t.Errorf("webtest: request did not reach the server middleware chain")
+		return r
+	}
+	val, ok := r.ctx.Get(key)
+	if !ok {
+		r.t.Errorf("webtest: context key '%s' does not exist", key)
+		return r
+	}
+	assert.Equal(r.t, want, val, "context value %s", key)
+	return r
+}
+
+// Aborted 断言中间件链是否被中断
+func (r *Response) Aborted(aborted bool) *Response {
+	r.t.Helper()
+	if r.ctx == nil {
+		r.t.Errorf("webtest: request did not reach the server middleware chain")
+		return r
+	}
+	assert.Equal(r.t, aborted, r.ctx.IsAborted(), "aborted")
+	return r
+}
+
+// lookup 支持 $、$.a.b、$.a[0].b 这样的简单路径
+func lookup(val any, path string) (any, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path must start with $: %s", path)
+	}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			obj, ok := val.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("json path %s: '%s' is not an object field", path, key)
+			}
+			if val, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("json path %s: key '%s' does not exist", path, key)
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %s: missing ]", path)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("json path %s: invalid index %s", path, rest[1:end])
+			}
+			rest = rest[end+1:]
+			arr, ok := val.([]any)
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("json path %s: index %d out of range", path, idx)
+			}
+			val = arr[idx]
+		default:
+			return nil, fmt.Errorf("json path %s: unexpected '%c'", path, rest[0])
+		}
+	}
+	return val, nil
+}
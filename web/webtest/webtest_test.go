@@ -0,0 +1,109 @@
+package webtest
+
+import (
+	"WebFramework/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	s := web.NewHttpServer(web.WithMiddleware(func(next web.HandleFunc) web.HandleFunc {
+		return func(c *web.Context) {
+			c.Set("trace", "123")
+			next(c)
+		}
+	}))
+	s.Post("/login", func(c *web.Context) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		_ = c.BindJSON(&req)
+		c.SetCookie(&http.Cookie{Name: "session", Value: req.Name, Path: "/"})
+		c.JSON(http.StatusOK, map[string]any{"name": req.Name})
+	})
+	s.Get("/user/:id", func(c *web.Context) {
+		cookie, err := c.Request.Cookie("session")
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]any{
+			"id":     c.PathValue("id").Val,
+			"name":   cookie.Value,
+			"tags":   []string{c.QueryValue("tag").Val},
+			"header": c.Request.Header.Get("X-Token"),
+		})
+	})
+
+	client := New(t, s)
+	client.Get("/user/1").Expect().Status(http.StatusUnauthorized).Aborted(true)
+
+	client.Post("/login").WithJSON(map[string]string{"name": "ppp"}).Expect().
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json; charset=utf-8").
+		JSON(map[string]string{"name": "ppp"}).
+		JSONPath("$.name", "ppp")
+
+	// cookie 被保存下来了
+	client.Get("/user/1").WithQuery("tag", "vip").WithHeader("X-Token", "abc").Expect().
+		Status(http.StatusOK).
+		Route("/user/:id").
+		Value("trace", "123").
+		JSONPath("$.name", "ppp").
+		JSONPath("$.tags[0]", "vip").
+		JSONPath("$.header", "abc").
+		Aborted(false)
+
+	client.Get("/unknown").Expect().Status(http.StatusNotFound).Body("Not Found").Route("")
+}
+
+func TestClient_Parallel(t *testing.T) {
+	s := web.NewHttpServer()
+	s.Get("/user/:id", func(c *web.Context) {
+		c.RespData = []byte(c.PathValue("id").Val)
+	})
+	client := New(t, s)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			resp := client.Get("/user/" + id).Expect().Body(id)
+			// 每个响应拿到的是自己那次请求的 Context
+			assert.Equal(t, id, resp.Context().PathValue("id").Val)
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+}
+
+func TestLookup(t *testing.T) {
+	val := map[string]any{
+		"user":  map[string]any{"name": "ppp"},
+		"items": []any{map[string]any{"id": float64(1)}},
+	}
+	testcase := []struct {
+		path    string
+		want    any
+		wantErr bool
+	}{
+		{path: "$", want: val},
+		{path: "$.user.name", want: "ppp"},
+		{path: "$.items[0].id", want: float64(1)},
+		{path: "$.items[1]", wantErr: true},
+		{path: "$.unknown", wantErr: true},
+		{path: "user", wantErr: true},
+	}
+	for _, tt := range testcase {
+		t.Run(tt.path, func(t *testing.T) {
+			actual, err := lookup(val, tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}